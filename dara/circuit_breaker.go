@@ -0,0 +1,303 @@
+package dara
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit of a host
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every request until the cool-down is over
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through to decide whether the host recovered
+	CircuitHalfOpen
+)
+
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(state))
+}
+
+// Defaults of the CircuitBreakerOptions left unset
+const (
+	DefaultCircuitFailureRatio     = 0.5
+	DefaultCircuitMinRequests      = 10
+	DefaultCircuitWindow           = time.Minute
+	DefaultCircuitCoolDown         = 30 * time.Second
+	DefaultCircuitHalfOpenRequests = 1
+)
+
+// CircuitBreakerOptions configures a CircuitBreaker, zero values take the defaults.
+// The circuit of a host opens once at least MinRequests were sent to it within the
+// current Window and FailureRatio of them failed, it stays open for CoolDown and then
+// lets HalfOpenRequests probes through: a successful probe closes the circuit, a
+// failed one opens it again.
+type CircuitBreakerOptions struct {
+	FailureRatio     float64
+	MinRequests      int
+	Window           time.Duration
+	CoolDown         time.Duration
+	HalfOpenRequests int
+	// OnStateChange is called whenever the circuit of a host changes state
+	OnStateChange func(host string, from, to CircuitState)
+	Clock         Clock
+}
+
+// CircuitSnapshot is the observable state of the circuit of a host
+type CircuitSnapshot struct {
+	Host  string
+	State CircuitState
+	// Requests and Failures are counted in the current window
+	Requests int
+	Failures int
+	// OpenedAt is when the circuit last opened, zero if it never did
+	OpenedAt time.Time
+}
+
+// CircuitOpenError is returned instead of sending a request to a host whose circuit is open
+type CircuitOpenError struct {
+	Host string
+}
+
+func (err *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open for host %s", err.Host)
+}
+
+// GetName returns "CircuitOpen" so that retry conditions can match it
+func (err *CircuitOpenError) GetName() *string {
+	return String("CircuitOpen")
+}
+
+// GetCode returns "CircuitOpen"
+func (err *CircuitOpenError) GetCode() *string {
+	return String("CircuitOpen")
+}
+
+type circuit struct {
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+}
+
+// circuitOutcome is the result of a request reported to the breaker
+type circuitOutcome int
+
+const (
+	circuitSuccess circuitOutcome = iota
+	circuitFailure
+	// circuitIgnored releases the request without counting it, as for requests cancelled by the caller
+	circuitIgnored
+)
+
+// CircuitBreaker tracks the health of every host it is used for and stops sending
+// requests to the hosts that keep failing. It may be shared by any number of runtimes.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	options  CircuitBreakerOptions
+	circuits map[string]*circuit
+}
+
+// NewCircuitBreaker creates a CircuitBreaker, options may be nil to take the defaults
+func NewCircuitBreaker(options *CircuitBreakerOptions) *CircuitBreaker {
+	breaker := &CircuitBreaker{
+		circuits: make(map[string]*circuit),
+	}
+	if options != nil {
+		breaker.options = *options
+	}
+	if breaker.options.FailureRatio <= 0 {
+		breaker.options.FailureRatio = DefaultCircuitFailureRatio
+	}
+	if breaker.options.MinRequests <= 0 {
+		breaker.options.MinRequests = DefaultCircuitMinRequests
+	}
+	if breaker.options.Window <= 0 {
+		breaker.options.Window = DefaultCircuitWindow
+	}
+	if breaker.options.CoolDown <= 0 {
+		breaker.options.CoolDown = DefaultCircuitCoolDown
+	}
+	if breaker.options.HalfOpenRequests <= 0 {
+		breaker.options.HalfOpenRequests = DefaultCircuitHalfOpenRequests
+	}
+	if breaker.options.Clock == nil {
+		breaker.options.Clock = SystemClock
+	}
+	return breaker
+}
+
+func (breaker *CircuitBreaker) circuit(host string, now time.Time) *circuit {
+	c, ok := breaker.circuits[host]
+	if !ok {
+		c = &circuit{windowStart: now}
+		breaker.circuits[host] = c
+	}
+	if c.state == CircuitClosed && now.Sub(c.windowStart) >= breaker.options.Window {
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+	return c
+}
+
+// setState must be called with the lock held, it returns the callback reporting the change
+func (breaker *CircuitBreaker) setState(host string, c *circuit, state CircuitState, now time.Time) func() {
+	from := c.state
+	c.state = state
+	c.probes = 0
+	switch state {
+	case CircuitOpen:
+		c.openedAt = now
+	case CircuitClosed:
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+	if onStateChange := breaker.options.OnStateChange; onStateChange != nil && from != state {
+		return func() { onStateChange(host, from, state) }
+	}
+	return func() {}
+}
+
+// allow returns a CircuitOpenError when no request may be sent to host,
+// every allowed request must be reported with done
+func (breaker *CircuitBreaker) allow(host string) error {
+	breaker.mu.Lock()
+	now := breaker.options.Clock.Now()
+	c := breaker.circuit(host, now)
+	notify := func() {}
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= breaker.options.CoolDown {
+		notify = breaker.setState(host, c, CircuitHalfOpen, now)
+	}
+	var err error
+	switch c.state {
+	case CircuitOpen:
+		err = &CircuitOpenError{Host: host}
+	case CircuitHalfOpen:
+		if c.probes >= breaker.options.HalfOpenRequests {
+			err = &CircuitOpenError{Host: host}
+		} else {
+			c.probes++
+		}
+	}
+	breaker.mu.Unlock()
+	notify()
+	return err
+}
+
+// done reports the outcome of a request allowed by allow
+func (breaker *CircuitBreaker) done(host string, outcome circuitOutcome) {
+	breaker.mu.Lock()
+	now := breaker.options.Clock.Now()
+	c := breaker.circuit(host, now)
+	notify := func() {}
+	switch c.state {
+	case CircuitHalfOpen:
+		switch outcome {
+		case circuitSuccess:
+			notify = breaker.setState(host, c, CircuitClosed, now)
+		case circuitFailure:
+			notify = breaker.setState(host, c, CircuitOpen, now)
+		default:
+			if c.probes > 0 {
+				c.probes--
+			}
+		}
+	case CircuitClosed:
+		if outcome == circuitIgnored {
+			break
+		}
+		c.requests++
+		if outcome == circuitFailure {
+			c.failures++
+		}
+		if c.requests >= breaker.options.MinRequests &&
+			float64(c.failures) >= breaker.options.FailureRatio*float64(c.requests) {
+			notify = breaker.setState(host, c, CircuitOpen, now)
+		}
+	}
+	breaker.mu.Unlock()
+	notify()
+}
+
+// State returns the state of the circuit of host
+func (breaker *CircuitBreaker) State(host string) CircuitState {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	c, ok := breaker.circuits[host]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && breaker.options.Clock.Now().Sub(c.openedAt) >= breaker.options.CoolDown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// Snapshot lists the circuits of every host seen so far, ordered by host
+func (breaker *CircuitBreaker) Snapshot() []*CircuitSnapshot {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	now := breaker.options.Clock.Now()
+	snapshots := make([]*CircuitSnapshot, 0, len(breaker.circuits))
+	for host, c := range breaker.circuits {
+		state := c.state
+		if state == CircuitOpen && now.Sub(c.openedAt) >= breaker.options.CoolDown {
+			state = CircuitHalfOpen
+		}
+		snapshots = append(snapshots, &CircuitSnapshot{
+			Host:     host,
+			State:    state,
+			Requests: c.requests,
+			Failures: c.failures,
+			OpenedAt: c.openedAt,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Host < snapshots[j].Host
+	})
+	return snapshots
+}
+
+// circuitOutcomeOf classifies the result of a request, transport errors and 5xx responses are failures
+func circuitOutcomeOf(ctx context.Context, res *http.Response, err error) circuitOutcome {
+	if err != nil {
+		if ctx.Err() != nil {
+			return circuitIgnored
+		}
+		return circuitFailure
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		return circuitFailure
+	}
+	return circuitSuccess
+}
+
+// Reset closes the circuit of host
+func (breaker *CircuitBreaker) Reset(host string) {
+	breaker.mu.Lock()
+	notify := func() {}
+	if c, ok := breaker.circuits[host]; ok {
+		notify = breaker.setState(host, c, CircuitClosed, breaker.options.Clock.Now())
+	}
+	breaker.mu.Unlock()
+	notify()
+}
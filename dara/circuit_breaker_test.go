@@ -0,0 +1,159 @@
+package dara
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.now = clock.now.Add(d)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func Test_CircuitBreaker(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []string
+	breaker := NewCircuitBreaker(&CircuitBreakerOptions{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		Window:       time.Minute,
+		CoolDown:     10 * time.Second,
+		Clock:        clock,
+		OnStateChange: func(host string, from, to CircuitState) {
+			transitions = append(transitions, host+" "+from.String()+"->"+to.String())
+		},
+	})
+	host := "ecs.aliyuncs.com"
+
+	// the failure ratio only counts once MinRequests were seen
+	for i := 0; i < 3; i++ {
+		utils.AssertNil(t, breaker.allow(host))
+		breaker.done(host, circuitFailure)
+	}
+	utils.AssertEqual(t, CircuitClosed, breaker.State(host))
+
+	// a new window starts over
+	clock.Advance(time.Minute)
+	utils.AssertNil(t, breaker.allow(host))
+	breaker.done(host, circuitFailure)
+	utils.AssertEqual(t, CircuitClosed, breaker.State(host))
+
+	for _, outcome := range []circuitOutcome{circuitSuccess, circuitIgnored, circuitSuccess, circuitFailure} {
+		utils.AssertNil(t, breaker.allow(host))
+		breaker.done(host, outcome)
+	}
+	utils.AssertEqual(t, CircuitOpen, breaker.State(host))
+	err := breaker.allow(host)
+	utils.AssertEqual(t, "CircuitOpen", StringValue(err.(BaseError).GetName()))
+	utils.AssertEqual(t, "CircuitOpen", StringValue(err.(BaseError).GetCode()))
+	utils.AssertEqual(t, "circuit breaker is open for host ecs.aliyuncs.com", err.Error())
+
+	// after the cool-down a single probe goes through, a failed probe opens the circuit again
+	clock.Advance(10 * time.Second)
+	utils.AssertEqual(t, CircuitHalfOpen, breaker.State(host))
+	utils.AssertNil(t, breaker.allow(host))
+	utils.AssertNotNil(t, breaker.allow(host))
+	breaker.done(host, circuitFailure)
+	utils.AssertEqual(t, CircuitOpen, breaker.State(host))
+
+	// a cancelled probe releases its slot, a successful one closes the circuit
+	clock.Advance(10 * time.Second)
+	utils.AssertNil(t, breaker.allow(host))
+	breaker.done(host, circuitIgnored)
+	utils.AssertNil(t, breaker.allow(host))
+	breaker.done(host, circuitSuccess)
+	utils.AssertEqual(t, CircuitClosed, breaker.State(host))
+
+	utils.AssertEqual(t, []string{
+		"ecs.aliyuncs.com closed->open",
+		"ecs.aliyuncs.com open->half-open",
+		"ecs.aliyuncs.com half-open->open",
+		"ecs.aliyuncs.com open->half-open",
+		"ecs.aliyuncs.com half-open->closed",
+	}, transitions)
+
+	utils.AssertNil(t, breaker.allow("vpc.aliyuncs.com"))
+	breaker.done("vpc.aliyuncs.com", circuitSuccess)
+	snapshots := breaker.Snapshot()
+	utils.AssertEqual(t, 2, len(snapshots))
+	utils.AssertEqual(t, "ecs.aliyuncs.com", snapshots[0].Host)
+	utils.AssertEqual(t, CircuitClosed, snapshots[0].State)
+	utils.AssertEqual(t, clock.now.Add(-10*time.Second), snapshots[0].OpenedAt)
+	utils.AssertEqual(t, "vpc.aliyuncs.com", snapshots[1].Host)
+	utils.AssertEqual(t, 1, snapshots[1].Requests)
+	utils.AssertEqual(t, 0, snapshots[1].Failures)
+	utils.AssertEqual(t, "CircuitState(5)", CircuitState(5).String())
+}
+
+func Test_circuitOutcomeOf(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	utils.AssertEqual(t, circuitSuccess, circuitOutcomeOf(ctx, &http.Response{StatusCode: 404}, nil))
+	utils.AssertEqual(t, circuitFailure, circuitOutcomeOf(ctx, &http.Response{StatusCode: 503}, nil))
+	utils.AssertEqual(t, circuitFailure, circuitOutcomeOf(ctx, nil, errors.New("connection refused")))
+	cancel()
+	utils.AssertEqual(t, circuitIgnored, circuitOutcomeOf(ctx, nil, context.Canceled))
+}
+
+func Test_DoRequestWithCircuitBreaker(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	calls := 0
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			calls++
+			return mockResponse(503, ``, nil)
+		}
+	}
+
+	breaker := NewCircuitBreaker(&CircuitBreakerOptions{MinRequests: 2, Clock: newFakeClock()})
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"circuitBreaker": breaker,
+	})
+	request := NewRequest()
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	for i := 0; i < 2; i++ {
+		resp, err := DoRequest(request, runtime)
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, 503, IntValue(resp.StatusCode))
+	}
+	utils.AssertEqual(t, CircuitOpen, breaker.State("ecs.aliyuncs.com"))
+
+	resp, err := DoRequest(request, runtime)
+	utils.AssertNil(t, resp)
+	utils.AssertEqual(t, 2, calls)
+	_, ok := err.(*CircuitOpenError)
+	utils.AssertEqual(t, true, ok)
+
+	// retry conditions can match the circuit open error by name
+	options := &RetryOptions{
+		Retryable: true,
+		NoRetryCondition: []*RetryCondition{
+			{Exception: []string{"CircuitOpen"}},
+		},
+		RetryCondition: []*RetryCondition{
+			{Exception: []string{"CircuitOpen"}, MaxAttempts: 3},
+		},
+	}
+	utils.AssertEqual(t, false, ShouldRetry(options, &RetryPolicyContext{RetriesAttempted: 1, Exception: err}))
+
+	// other hosts are not affected
+	request.Headers["host"] = String("vpc.aliyuncs.com")
+	_, err = DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+}
@@ -0,0 +1,143 @@
+package dara
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultClientPoolIdleTimeout is how long a pooled client may stay unused before it is evicted
+const DefaultClientPoolIdleTimeout = 10 * time.Minute
+
+// ClientPoolEntry describes a client cached in the shared client pool
+type ClientPoolEntry struct {
+	// Key is the hash of every runtime option the transport is built from
+	Key string
+	// Domain is the domain the transport was built for
+	Domain   string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+type pooledClient struct {
+	client   *daraClient
+	domain   string
+	created  time.Time
+	lastUsed time.Time
+}
+
+type daraClientPool struct {
+	sync.Mutex
+	clients     map[string]*pooledClient
+	idleTimeout time.Duration
+	lastSweep   time.Time
+}
+
+var clientPool = &daraClientPool{
+	clients:     make(map[string]*pooledClient),
+	idleTimeout: DefaultClientPoolIdleTimeout,
+}
+
+// get returns the client cached under key, building its transport with newTransport on a miss
+func (pool *daraClientPool) get(key, domain string, newTransport func() (*http.Transport, error)) (*daraClient, error) {
+	pool.Lock()
+	defer pool.Unlock()
+	now := time.Now()
+	pool.sweep(now)
+	if pooled, ok := pool.clients[key]; ok {
+		pooled.lastUsed = now
+		return pooled.client, nil
+	}
+	trans, err := newTransport()
+	if err != nil {
+		return nil, err
+	}
+	client := &daraClient{
+		httpClient: &http.Client{
+			Transport: trans,
+		},
+	}
+	pool.clients[key] = &pooledClient{
+		client:   client,
+		domain:   domain,
+		created:  now,
+		lastUsed: now,
+	}
+	return client, nil
+}
+
+// sweep evicts the clients idle for longer than the idle timeout, at most once per half timeout
+func (pool *daraClientPool) sweep(now time.Time) {
+	if pool.idleTimeout <= 0 || now.Sub(pool.lastSweep) < pool.idleTimeout/2 {
+		return
+	}
+	pool.lastSweep = now
+	pool.evict(func(pooled *pooledClient) bool {
+		return now.Sub(pooled.lastUsed) > pool.idleTimeout
+	})
+}
+
+func (pool *daraClientPool) evict(match func(pooled *pooledClient) bool) int {
+	count := 0
+	for key, pooled := range pool.clients {
+		if !match(pooled) {
+			continue
+		}
+		if trans, ok := pooled.client.httpClient.Transport.(*http.Transport); ok {
+			trans.CloseIdleConnections()
+		}
+		delete(pool.clients, key)
+		count++
+	}
+	return count
+}
+
+// SetClientPoolIdleTimeout sets how long a pooled client may stay unused before it is evicted,
+// a timeout of zero disables the eviction
+func SetClientPoolIdleTimeout(timeout time.Duration) {
+	clientPool.Lock()
+	defer clientPool.Unlock()
+	clientPool.idleTimeout = timeout
+}
+
+// GetClientPoolEntries lists the clients cached in the shared pool, ordered by domain
+func GetClientPoolEntries() []*ClientPoolEntry {
+	clientPool.Lock()
+	defer clientPool.Unlock()
+	entries := make([]*ClientPoolEntry, 0, len(clientPool.clients))
+	for key, pooled := range clientPool.clients {
+		entries = append(entries, &ClientPoolEntry{
+			Key:      key,
+			Domain:   pooled.domain,
+			Created:  pooled.created,
+			LastUsed: pooled.lastUsed,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Domain != entries[j].Domain {
+			return entries[i].Domain < entries[j].Domain
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// PurgeIdleClients evicts the pooled clients unused for longer than idle and returns how many were evicted
+func PurgeIdleClients(idle time.Duration) int {
+	clientPool.Lock()
+	defer clientPool.Unlock()
+	now := time.Now()
+	return clientPool.evict(func(pooled *pooledClient) bool {
+		return now.Sub(pooled.lastUsed) > idle
+	})
+}
+
+// PurgeClientPool evicts every pooled client and closes its idle connections
+func PurgeClientPool() int {
+	clientPool.Lock()
+	defer clientPool.Unlock()
+	return clientPool.evict(func(pooled *pooledClient) bool {
+		return true
+	})
+}
@@ -0,0 +1,100 @@
+package dara
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_getClientTag(t *testing.T) {
+	runtime := &RuntimeObject{}
+	tag := runtime.getClientTag("https", "ecs.aliyuncs.com")
+	utils.AssertEqual(t, tag, runtime.getClientTag("https", "ecs.aliyuncs.com"))
+	utils.AssertEqual(t, false, tag == runtime.getClientTag("http", "ecs.aliyuncs.com"))
+
+	runtime.Cert = String(cert)
+	runtime.Key = String(key)
+	withCert := runtime.getClientTag("https", "ecs.aliyuncs.com")
+	utils.AssertEqual(t, false, tag == withCert)
+	utils.AssertEqual(t, false, strings.Contains(withCert, "CERTIFICATE"))
+
+	runtime.Ca = String(ca)
+	utils.AssertEqual(t, false, withCert == runtime.getClientTag("https", "ecs.aliyuncs.com"))
+
+	runtime.MaxIdleConns = Int(10)
+	utils.AssertEqual(t, false, withCert == runtime.getClientTag("https", "ecs.aliyuncs.com"))
+
+	// fields are length prefixed so that moving a character between them changes the tag
+	a := &RuntimeObject{HttpProxy: String("ab"), HttpsProxy: String("c")}
+	b := &RuntimeObject{HttpProxy: String("a"), HttpsProxy: String("bc")}
+	utils.AssertEqual(t, false, a.getClientTag("http", "") == b.getClientTag("http", ""))
+}
+
+func Test_prepareTransportWithDifferentCertificates(t *testing.T) {
+	PurgeClientPool()
+	defer PurgeClientPool()
+
+	request := NewRequest()
+	request.Protocol = String("https")
+	request.Headers["host"] = String("pool.aliyuncs.com")
+	normalizeRequest(request)
+
+	withCert := &RuntimeObject{Key: String(key), Cert: String(cert)}
+	withCa := &RuntimeObject{Key: String(key), Cert: String(cert), Ca: String(ca)}
+
+	client1, trans1, err := prepareTransport(request, withCert)
+	utils.AssertNil(t, err)
+	client2, trans2, err := prepareTransport(request, withCa)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, false, client1 == client2)
+	utils.AssertEqual(t, false, trans1 == trans2)
+	utils.AssertNil(t, trans1.TLSClientConfig.RootCAs)
+	utils.AssertNotNil(t, trans2.TLSClientConfig.RootCAs)
+
+	client3, trans3, err := prepareTransport(request, &RuntimeObject{Key: String(key), Cert: String(cert)})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, client1 == client3)
+	utils.AssertEqual(t, true, trans1 == trans3)
+
+	entries := GetClientPoolEntries()
+	utils.AssertEqual(t, 2, len(entries))
+	utils.AssertEqual(t, "pool.aliyuncs.com", entries[0].Domain)
+
+	// a broken certificate is never cached
+	_, _, err = prepareTransport(request, &RuntimeObject{Key: String("key"), Cert: String("cert")})
+	utils.AssertEqual(t, "tls: failed to find any PEM data in certificate input", err.Error())
+	utils.AssertEqual(t, 2, len(GetClientPoolEntries()))
+
+	utils.AssertEqual(t, 0, PurgeIdleClients(time.Hour))
+	utils.AssertEqual(t, 2, PurgeIdleClients(0))
+	utils.AssertEqual(t, 0, len(GetClientPoolEntries()))
+}
+
+func Test_clientPoolEviction(t *testing.T) {
+	PurgeClientPool()
+	defer func() {
+		SetClientPoolIdleTimeout(DefaultClientPoolIdleTimeout)
+		PurgeClientPool()
+	}()
+
+	request := NewRequest()
+	request.Headers["host"] = String("idle.aliyuncs.com")
+	normalizeRequest(request)
+	_, _, err := prepareTransport(request, &RuntimeObject{})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 1, len(GetClientPoolEntries()))
+
+	SetClientPoolIdleTimeout(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	request.Headers["host"] = String("fresh.aliyuncs.com")
+	normalizeRequest(request)
+	_, _, err = prepareTransport(request, &RuntimeObject{})
+	utils.AssertNil(t, err)
+	entries := GetClientPoolEntries()
+	utils.AssertEqual(t, 1, len(entries))
+	utils.AssertEqual(t, "fresh.aliyuncs.com", entries[0].Domain)
+
+	utils.AssertEqual(t, 1, PurgeClientPool())
+}
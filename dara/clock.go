@@ -0,0 +1,17 @@
+package dara
+
+import "time"
+
+// Clock tells the current time, it lets tests drive the time based policies
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock backed by time.Now
+var SystemClock Clock = systemClock{}
@@ -3,6 +3,7 @@ package dara
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -27,6 +28,7 @@ import (
 	util "github.com/alibabacloud-go/tea-utils/v2/service"
 	"github.com/alibabacloud-go/tea/utils"
 
+	"golang.org/x/net/http2"
 	"golang.org/x/net/proxy"
 )
 
@@ -35,6 +37,18 @@ type ExtendsParameters = util.ExtendsParameters
 
 var debugLog = debug.Init("dara")
 
+// Values of RuntimeObject.HttpVersion, leaving it empty keeps the transport on HTTP/1.1
+// without pinning the protocol
+const (
+	// HttpVersion11 forces HTTP/1.1
+	HttpVersion11 = "HTTP/1.1"
+	// HttpVersion2 negotiates HTTP/2 over TLS and falls back to HTTP/1.1
+	HttpVersion2 = "HTTP/2"
+	// HttpVersionH2C negotiates HTTP/2 over TLS and speaks HTTP/2 without TLS to http endpoints,
+	// which can not be reached through an http proxy
+	HttpVersionH2C = "h2c"
+)
+
 type HttpRequest interface {
 }
 
@@ -46,9 +60,7 @@ type HttpClient interface {
 }
 
 type daraClient struct {
-	sync.Mutex
 	httpClient *http.Client
-	ifInit     bool
 }
 
 func (client *daraClient) Call(request *http.Request, transport *http.Transport) (response *http.Response, err error) {
@@ -67,8 +79,6 @@ var basicTypes = []string{
 // Verify whether the parameters meet the requirements
 var validateParams = []string{"require", "pattern", "maxLength", "minLength", "maximum", "minimum", "maxItems", "minItems"}
 
-var clientPool = &sync.Map{}
-
 // Request is used wrap http request
 type Request struct {
 	Protocol *string
@@ -77,8 +87,14 @@ type Request struct {
 	Pathname *string
 	Domain   *string
 	Headers  map[string]*string
-	Query    map[string]*string
-	Body     io.Reader
+	// HeaderValues holds headers sent with several values, it overrides Headers for the same key
+	HeaderValues map[string][]string
+	Query        map[string]*string
+	// QueryParams are encoded after Query in their order, keys may repeat
+	QueryParams []*QueryParam
+	// QueryEncoder builds the query string, DefaultQueryEncoder is used when nil
+	QueryEncoder QueryEncoder
+	Body         io.Reader
 }
 
 // Response is use d wrap http response
@@ -86,37 +102,84 @@ type Response struct {
 	Body          io.ReadCloser
 	StatusCode    *int
 	StatusMessage *string
-	Headers       map[string]*string
+	// Proto is the protocol the response was received with, such as "HTTP/2.0"
+	Proto *string
+	// Headers holds the first value of every header, keyed by lower-case name
+	Headers map[string]*string
+	// HeaderValues holds all values of every header, keyed by lower-case name
+	HeaderValues map[string][]string
 }
 
-// RuntimeObject is used for converting http configuration
+// RuntimeObject is used for converting http configuration, every timeout is in milliseconds.
+// BodyIdleTimeout aborts reading the response body once no data arrived for that long.
+// RateLimiter, ConcurrencyLimiter and HostLimiter hold the request until it may be sent,
+// a concurrency slot is given back once the response headers arrived.
 type RuntimeObject struct {
-	IgnoreSSL         *bool                  `json:"ignoreSSL" xml:"ignoreSSL"`
-	ReadTimeout       *int                   `json:"readTimeout" xml:"readTimeout"`
-	ConnectTimeout    *int                   `json:"connectTimeout" xml:"connectTimeout"`
-	IdleTimeout       *int                   `json:"idleTimeout" xml:"idleTimeout"`
-	LocalAddr         *string                `json:"localAddr" xml:"localAddr"`
-	HttpProxy         *string                `json:"httpProxy" xml:"httpProxy"`
-	HttpsProxy        *string                `json:"httpsProxy" xml:"httpsProxy"`
-	NoProxy           *string                `json:"noProxy" xml:"noProxy"`
-	MaxIdleConns      *int                   `json:"maxIdleConns" xml:"maxIdleConns"`
-	Key               *string                `json:"key" xml:"key"`
-	Cert              *string                `json:"cert" xml:"cert"`
-	Ca                *string                `json:"ca" xml:"ca"`
-	Socks5Proxy       *string                `json:"socks5Proxy" xml:"socks5Proxy"`
-	Socks5NetWork     *string                `json:"socks5NetWork" xml:"socks5NetWork"`
-	Listener          utils.ProgressListener `json:"listener" xml:"listener"`
-	Tracker           *utils.ReaderTracker   `json:"tracker" xml:"tracker"`
-	Logger            *utils.Logger          `json:"logger" xml:"logger"`
-	RetryOptions      *RetryOptions          `json:"retryOptions" xml:"retryOptions"`
-	ExtendsParameters *ExtendsParameters     `json:"extendsParameters,omitempty" xml:"extendsParameters,omitempty"`
+	IgnoreSSL             *bool                  `json:"ignoreSSL" xml:"ignoreSSL"`
+	ReadTimeout           *int                   `json:"readTimeout" xml:"readTimeout"`
+	ConnectTimeout        *int                   `json:"connectTimeout" xml:"connectTimeout"`
+	IdleTimeout           *int                   `json:"idleTimeout" xml:"idleTimeout"`
+	TLSHandshakeTimeout   *int                   `json:"tlsHandshakeTimeout" xml:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout *int                   `json:"responseHeaderTimeout" xml:"responseHeaderTimeout"`
+	ExpectContinueTimeout *int                   `json:"expectContinueTimeout" xml:"expectContinueTimeout"`
+	BodyIdleTimeout       *int                   `json:"bodyIdleTimeout" xml:"bodyIdleTimeout"`
+	LocalAddr             *string                `json:"localAddr" xml:"localAddr"`
+	HttpProxy             *string                `json:"httpProxy" xml:"httpProxy"`
+	HttpsProxy            *string                `json:"httpsProxy" xml:"httpsProxy"`
+	NoProxy               *string                `json:"noProxy" xml:"noProxy"`
+	MaxIdleConns          *int                   `json:"maxIdleConns" xml:"maxIdleConns"`
+	Key                   *string                `json:"key" xml:"key"`
+	Cert                  *string                `json:"cert" xml:"cert"`
+	Ca                    *string                `json:"ca" xml:"ca"`
+	Socks5Proxy           *string                `json:"socks5Proxy" xml:"socks5Proxy"`
+	Socks5NetWork         *string                `json:"socks5NetWork" xml:"socks5NetWork"`
+	HttpVersion           *string                `json:"httpVersion" xml:"httpVersion"`
+	Listener              utils.ProgressListener `json:"listener" xml:"listener"`
+	Tracker               *utils.ReaderTracker   `json:"tracker" xml:"tracker"`
+	Logger                *utils.Logger          `json:"logger" xml:"logger"`
+	StructuredLogger      utils.StructuredLogger `json:"-" xml:"-"`
+	RetryOptions          *RetryOptions          `json:"retryOptions" xml:"retryOptions"`
+	Interceptors          []Interceptor          `json:"-" xml:"-"`
+	CircuitBreaker        *CircuitBreaker        `json:"-" xml:"-"`
+	RateLimiter           *RateLimiter           `json:"-" xml:"-"`
+	ConcurrencyLimiter    *ConcurrencyLimiter    `json:"-" xml:"-"`
+	HostLimiter           *HostLimiter           `json:"-" xml:"-"`
+	Hedging               *HedgingPolicy         `json:"-" xml:"-"`
+	ExtendsParameters     *ExtendsParameters     `json:"extendsParameters,omitempty" xml:"extendsParameters,omitempty"`
 	HttpClient
 }
 
-func (r *RuntimeObject) getClientTag(domain string) string {
-	return strconv.FormatBool(BoolValue(r.IgnoreSSL)) + strconv.Itoa(IntValue(r.ReadTimeout)) +
-		strconv.Itoa(IntValue(r.ConnectTimeout)) + strconv.Itoa(IntValue(r.IdleTimeout)) + StringValue(r.LocalAddr) + StringValue(r.HttpProxy) +
-		StringValue(r.HttpsProxy) + StringValue(r.NoProxy) + StringValue(r.Socks5Proxy) + StringValue(r.Socks5NetWork) + domain
+// getClientTag hashes every option the pooled client and its transport are built from,
+// so that runtimes differing in any of them never share a transport
+func (r *RuntimeObject) getClientTag(protocol, domain string) string {
+	fields := []string{
+		protocol,
+		domain,
+		strconv.FormatBool(BoolValue(r.IgnoreSSL)),
+		strconv.Itoa(IntValue(r.ConnectTimeout)),
+		strconv.Itoa(IntValue(r.IdleTimeout)),
+		strconv.Itoa(IntValue(r.TLSHandshakeTimeout)),
+		strconv.Itoa(IntValue(r.ResponseHeaderTimeout)),
+		strconv.Itoa(IntValue(r.ExpectContinueTimeout)),
+		strconv.Itoa(IntValue(r.MaxIdleConns)),
+		StringValue(r.LocalAddr),
+		StringValue(r.HttpProxy),
+		StringValue(r.HttpsProxy),
+		StringValue(r.NoProxy),
+		StringValue(r.Socks5Proxy),
+		StringValue(r.Socks5NetWork),
+		StringValue(r.HttpVersion),
+		StringValue(r.Key),
+		StringValue(r.Cert),
+		StringValue(r.Ca),
+	}
+	hash := sha256.New()
+	for _, field := range fields {
+		hash.Write([]byte(strconv.Itoa(len(field))))
+		hash.Write([]byte{':'})
+		hash.Write([]byte(field))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
 // NewRuntimeObject is used for shortly create runtime object
@@ -126,20 +189,25 @@ func NewRuntimeObject(runtime map[string]interface{}) *RuntimeObject {
 	}
 
 	runtimeObject := &RuntimeObject{
-		IgnoreSSL:      TransInterfaceToBool(runtime["ignoreSSL"]),
-		ReadTimeout:    TransInterfaceToInt(runtime["readTimeout"]),
-		ConnectTimeout: TransInterfaceToInt(runtime["connectTimeout"]),
-		IdleTimeout:    TransInterfaceToInt(runtime["idleTimeout"]),
-		LocalAddr:      TransInterfaceToString(runtime["localAddr"]),
-		HttpProxy:      TransInterfaceToString(runtime["httpProxy"]),
-		HttpsProxy:     TransInterfaceToString(runtime["httpsProxy"]),
-		NoProxy:        TransInterfaceToString(runtime["noProxy"]),
-		MaxIdleConns:   TransInterfaceToInt(runtime["maxIdleConns"]),
-		Socks5Proxy:    TransInterfaceToString(runtime["socks5Proxy"]),
-		Socks5NetWork:  TransInterfaceToString(runtime["socks5NetWork"]),
-		Key:            TransInterfaceToString(runtime["key"]),
-		Cert:           TransInterfaceToString(runtime["cert"]),
-		Ca:             TransInterfaceToString(runtime["ca"]),
+		IgnoreSSL:             TransInterfaceToBool(runtime["ignoreSSL"]),
+		ReadTimeout:           TransInterfaceToInt(runtime["readTimeout"]),
+		ConnectTimeout:        TransInterfaceToInt(runtime["connectTimeout"]),
+		IdleTimeout:           TransInterfaceToInt(runtime["idleTimeout"]),
+		TLSHandshakeTimeout:   TransInterfaceToInt(runtime["tlsHandshakeTimeout"]),
+		ResponseHeaderTimeout: TransInterfaceToInt(runtime["responseHeaderTimeout"]),
+		ExpectContinueTimeout: TransInterfaceToInt(runtime["expectContinueTimeout"]),
+		BodyIdleTimeout:       TransInterfaceToInt(runtime["bodyIdleTimeout"]),
+		LocalAddr:             TransInterfaceToString(runtime["localAddr"]),
+		HttpProxy:             TransInterfaceToString(runtime["httpProxy"]),
+		HttpsProxy:            TransInterfaceToString(runtime["httpsProxy"]),
+		NoProxy:               TransInterfaceToString(runtime["noProxy"]),
+		MaxIdleConns:          TransInterfaceToInt(runtime["maxIdleConns"]),
+		Socks5Proxy:           TransInterfaceToString(runtime["socks5Proxy"]),
+		Socks5NetWork:         TransInterfaceToString(runtime["socks5NetWork"]),
+		Key:                   TransInterfaceToString(runtime["key"]),
+		Cert:                  TransInterfaceToString(runtime["cert"]),
+		Ca:                    TransInterfaceToString(runtime["ca"]),
+		HttpVersion:           TransInterfaceToString(runtime["httpVersion"]),
 	}
 	if runtime["listener"] != nil {
 		runtimeObject.Listener = runtime["listener"].(utils.ProgressListener)
@@ -150,11 +218,35 @@ func NewRuntimeObject(runtime map[string]interface{}) *RuntimeObject {
 	if runtime["logger"] != nil {
 		runtimeObject.Logger = runtime["logger"].(*utils.Logger)
 	}
+	if runtime["structuredLogger"] != nil {
+		runtimeObject.StructuredLogger = runtime["structuredLogger"].(utils.StructuredLogger)
+	}
 	if runtime["httpClient"] != nil {
 		runtimeObject.HttpClient = runtime["httpClient"].(HttpClient)
 	}
-	if runtime["retryOptions"] != nil {
-		runtimeObject.RetryOptions = runtime["retryOptions"].(*RetryOptions)
+	switch retryOptions := runtime["retryOptions"].(type) {
+	case *RetryOptions:
+		runtimeObject.RetryOptions = retryOptions
+	case map[string]interface{}:
+		runtimeObject.RetryOptions = NewRetryOptions(retryOptions)
+	}
+	if runtime["interceptors"] != nil {
+		runtimeObject.Interceptors = runtime["interceptors"].([]Interceptor)
+	}
+	if runtime["circuitBreaker"] != nil {
+		runtimeObject.CircuitBreaker = runtime["circuitBreaker"].(*CircuitBreaker)
+	}
+	if runtime["rateLimiter"] != nil {
+		runtimeObject.RateLimiter = runtime["rateLimiter"].(*RateLimiter)
+	}
+	if runtime["concurrencyLimiter"] != nil {
+		runtimeObject.ConcurrencyLimiter = runtime["concurrencyLimiter"].(*ConcurrencyLimiter)
+	}
+	if runtime["hostLimiter"] != nil {
+		runtimeObject.HostLimiter = runtime["hostLimiter"].(*HostLimiter)
+	}
+	if runtime["hedging"] != nil {
+		runtimeObject.Hedging = runtime["hedging"].(*HedgingPolicy)
 	}
 	return runtimeObject
 }
@@ -162,8 +254,9 @@ func NewRuntimeObject(runtime map[string]interface{}) *RuntimeObject {
 // NewRequest is used shortly create Request
 func NewRequest() (req *Request) {
 	return &Request{
-		Headers: map[string]*string{},
-		Query:   map[string]*string{},
+		Headers:      map[string]*string{},
+		HeaderValues: map[string][]string{},
+		Query:        map[string]*string{},
 	}
 }
 
@@ -172,8 +265,20 @@ func NewResponse(httpResponse *http.Response) (res *Response) {
 	res = &Response{}
 	res.Body = httpResponse.Body
 	res.Headers = make(map[string]*string)
+	res.HeaderValues = make(map[string][]string)
+	for key, value := range httpResponse.Header {
+		if len(value) == 0 {
+			continue
+		}
+		key = strings.ToLower(key)
+		res.Headers[key] = String(value[0])
+		res.HeaderValues[key] = append(res.HeaderValues[key], value...)
+	}
 	res.StatusCode = Int(httpResponse.StatusCode)
 	res.StatusMessage = String(httpResponse.Status)
+	if httpResponse.Proto != "" {
+		res.Proto = String(httpResponse.Proto)
+	}
 	return
 }
 
@@ -245,149 +350,152 @@ func (response *Response) ReadBody() (body []byte, err error) {
 	return result.Bytes(), nil
 }
 
-func getDaraClient(tag string) *daraClient {
-	client, ok := clientPool.Load(tag)
-	if client == nil && !ok {
-		client = &daraClient{
-			httpClient: &http.Client{},
-			ifInit:     false,
-		}
-		clientPool.Store(tag, client)
-	}
-	return client.(*daraClient)
-}
-
 // DoRequest is used send request to server
 func DoRequest(request *Request, runtimeObject *RuntimeObject) (response *Response, err error) {
+	return DoRequestWithCtx(context.Background(), request, runtimeObject)
+}
+
+// DoRequestWithCtx is used send request to server, the request is bound to ctx.
+// GET and HEAD requests without a body are hedged when the runtime has a Hedging policy.
+// A response which is no failure is recorded as a success by the retry budget of the runtime.
+func DoRequestWithCtx(ctx context.Context, request *Request, runtimeObject *RuntimeObject) (response *Response, err error) {
 	if runtimeObject == nil {
 		runtimeObject = &RuntimeObject{}
 	}
-	fieldMap := make(map[string]string)
-	utils.InitLogMsg(fieldMap)
+	if runtimeObject.Hedging != nil && isHedgeable(request) {
+		response, err = doHedgedRequest(ctx, request, runtimeObject)
+	} else {
+		response, err = doRequest(ctx, request, runtimeObject)
+	}
+	if err == nil {
+		recordBudgetSuccess(runtimeObject.RetryOptions, request, response)
+	}
+	return
+}
+
+// doRequest sends a single copy of the request
+func doRequest(ctx context.Context, request *Request, runtimeObject *RuntimeObject) (response *Response, err error) {
+	record := &utils.LogRecord{}
 	defer func() {
-		if runtimeObject.Logger != nil {
-			runtimeObject.Logger.PrintLog(fieldMap, err)
-		}
+		record.Time = time.Now()
+		record.Error = err
+		logRequest(runtimeObject, record)
 	}()
-	if request.Method == nil {
-		request.Method = String("GET")
-	}
 
-	if request.Protocol == nil {
-		request.Protocol = String("http")
-	} else {
-		request.Protocol = String(strings.ToLower(StringValue(request.Protocol)))
-	}
+	normalizeRequest(request)
+	requestURL := buildRequestURL(request)
+	debugLog("> %s %s", StringValue(request.Method), utils.GetDebugRedactionPolicy().RedactURI(requestURL))
 
-	requestURL := ""
-	request.Domain = request.Headers["host"]
-	if request.Port != nil {
-		request.Domain = String(fmt.Sprintf("%s:%d", StringValue(request.Domain), IntValue(request.Port)))
-	}
-	requestURL = fmt.Sprintf("%s://%s%s", StringValue(request.Protocol), StringValue(request.Domain), StringValue(request.Pathname))
-	queryParams := request.Query
-	// sort QueryParams by key
-	q := url.Values{}
-	for key, value := range queryParams {
-		q.Add(key, StringValue(value))
-	}
-	querystring := q.Encode()
-	if len(querystring) > 0 {
-		if strings.Contains(requestURL, "?") {
-			requestURL = fmt.Sprintf("%s&%s", requestURL, querystring)
-		} else {
-			requestURL = fmt.Sprintf("%s?%s", requestURL, querystring)
+	requestCtx, cancel := withReadTimeout(ctx, runtimeObject)
+	defer func() {
+		if err != nil {
+			cancel()
 		}
-	}
-	debugLog("> %s %s", StringValue(request.Method), requestURL)
-
-	httpRequest, err := http.NewRequest(StringValue(request.Method), requestURL, request.Body)
+	}()
+	httpRequest, err := http.NewRequestWithContext(requestCtx, StringValue(request.Method), requestURL, request.Body)
 	if err != nil {
 		return
 	}
 	httpRequest.Host = StringValue(request.Domain)
 
-	var client HttpClient
-	if runtimeObject.HttpClient == nil {
-		client = getDaraClient(runtimeObject.getClientTag(StringValue(request.Domain)))
-	} else {
-		client = runtimeObject.HttpClient
+	client, trans, err := prepareTransport(request, runtimeObject)
+	if err != nil {
+		return
 	}
+	setRequestHeaders(httpRequest, request)
 
-	trans, err := getHttpTransport(request, runtimeObject)
+	res, err := sendRequest(ctx, httpRequest, client, trans, request, runtimeObject, record)
 	if err != nil {
 		return
 	}
-	if defaultClient, ok := client.(*daraClient); ok {
-		defaultClient.Lock()
-		if !defaultClient.ifInit || defaultClient.httpClient.Transport == nil {
-			defaultClient.httpClient.Transport = trans
-		}
-		defaultClient.httpClient.Timeout = time.Duration(IntValue(runtimeObject.ReadTimeout)) * time.Millisecond
-		defaultClient.ifInit = true
-		defaultClient.Unlock()
+	res.Body = &cancelOnCloseBody{ReadCloser: res.Body, cancel: cancel}
+	if bodyIdleTimeout := IntValue(runtimeObject.BodyIdleTimeout); bodyIdleTimeout > 0 {
+		res.Body = newIdleTimeoutBody(res.Body, time.Duration(bodyIdleTimeout)*time.Millisecond, cancel)
 	}
+	res.Body = &transportErrorBody{ReadCloser: res.Body, ctx: ctx}
+	response = decodeResponse(res, record)
+	return
+}
 
-	for key, value := range request.Headers {
-		if value == nil || key == "content-length" {
-			continue
-		} else if key == "host" {
-			httpRequest.Header["Host"] = []string{*value}
-			delete(httpRequest.Header, "host")
-		} else if key == "user-agent" {
-			httpRequest.Header["User-Agent"] = []string{*value}
-			delete(httpRequest.Header, "user-agent")
-		} else {
-			httpRequest.Header[key] = []string{*value}
-		}
-		debugLog("> %s: %s", key, StringValue(value))
+// withReadTimeout bounds the whole exchange, reading the body included, by the ReadTimeout
+// of the runtime. The pooled clients have no timeout so concurrent requests never share one.
+func withReadTimeout(ctx context.Context, runtimeObject *RuntimeObject) (context.Context, context.CancelFunc) {
+	if readTimeout := IntValue(runtimeObject.ReadTimeout); readTimeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(readTimeout)*time.Millisecond)
 	}
-	contentlength, _ := strconv.Atoi(StringValue(request.Headers["content-length"]))
-	event := utils.NewProgressEvent(utils.TransferStartedEvent, 0, int64(contentlength), 0)
-	utils.PublishProgress(runtimeObject.Listener, event)
+	return context.WithCancel(ctx)
+}
 
-	putMsgToMap(fieldMap, httpRequest)
-	startTime := time.Now()
-	fieldMap["{start_time}"] = startTime.Format("2006-01-02 15:04:05")
-	res, err := hookDo(client.Call)(httpRequest, trans)
-	fieldMap["{cost}"] = time.Since(startTime).String()
-	completedBytes := int64(0)
-	if runtimeObject.Tracker != nil {
-		completedBytes = runtimeObject.Tracker.CompletedBytes
-	}
-	if err != nil {
-		event = utils.NewProgressEvent(utils.TransferFailedEvent, completedBytes, int64(contentlength), 0)
-		utils.PublishProgress(runtimeObject.Listener, event)
-		return
-	}
+// cancelOnCloseBody releases the context of the request once its response body is closed
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
 
-	event = utils.NewProgressEvent(utils.TransferCompletedEvent, completedBytes, int64(contentlength), 0)
-	utils.PublishProgress(runtimeObject.Listener, event)
+func (body *cancelOnCloseBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
 
-	response = NewResponse(res)
-	fieldMap["{code}"] = strconv.Itoa(res.StatusCode)
-	fieldMap["{res_headers}"] = Stringify(res.Header)
-	debugLog("< HTTP/1.1 %s", res.Status)
-	for key, value := range res.Header {
-		debugLog("< %s: %s", key, strings.Join(value, ""))
-		if len(value) != 0 {
-			response.Headers[strings.ToLower(key)] = String(value[0])
-		}
+// idleTimeoutBody cancels the request when a single read waits for data longer than timeout
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	// reads counts the reads, a timer only cancels the read it was started for and only
+	// while that read is still blocked
+	reads   uint64
+	waiting bool
+	// expired is set once a blocked read was cancelled, the body fails from then on
+	expired bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	return &idleTimeoutBody{
+		ReadCloser: body,
+		timeout:    timeout,
+		cancel:     cancel,
 	}
-	return
 }
 
-func DoRequestWithCtx(ctx context.Context, request *Request, runtimeObject *RuntimeObject) (response *Response, err error) {
-	if runtimeObject == nil {
-		runtimeObject = &RuntimeObject{}
+func (body *idleTimeoutBody) Read(p []byte) (int, error) {
+	body.mu.Lock()
+	body.reads++
+	read := body.reads
+	body.waiting = true
+	body.mu.Unlock()
+	timer := time.AfterFunc(body.timeout, func() {
+		body.expire(read)
+	})
+	n, err := body.ReadCloser.Read(p)
+	timer.Stop()
+	body.mu.Lock()
+	body.waiting = false
+	expired := body.expired
+	body.mu.Unlock()
+	if err != nil && expired {
+		err = NewTransportError(TransportErrorReadTimeout, fmt.Errorf("read response body timeout: no data received for %s", body.timeout))
+	}
+	return n, err
+}
+
+// expire cancels the request when the read numbered read is still waiting for data,
+// a timer firing while its read returns is ignored
+func (body *idleTimeoutBody) expire(read uint64) {
+	body.mu.Lock()
+	if !body.waiting || body.reads != read {
+		body.mu.Unlock()
+		return
 	}
-	fieldMap := make(map[string]string)
-	utils.InitLogMsg(fieldMap)
-	defer func() {
-		if runtimeObject.Logger != nil {
-			runtimeObject.Logger.PrintLog(fieldMap, err)
-		}
-	}()
+	body.expired = true
+	body.mu.Unlock()
+	body.cancel()
+}
+
+// normalizeRequest fills the default method and protocol and resolves the domain
+func normalizeRequest(request *Request) {
 	if request.Method == nil {
 		request.Method = String("GET")
 	}
@@ -398,19 +506,16 @@ func DoRequestWithCtx(ctx context.Context, request *Request, runtimeObject *Runt
 		request.Protocol = String(strings.ToLower(StringValue(request.Protocol)))
 	}
 
-	requestURL := ""
 	request.Domain = request.Headers["host"]
 	if request.Port != nil {
 		request.Domain = String(fmt.Sprintf("%s:%d", StringValue(request.Domain), IntValue(request.Port)))
 	}
-	requestURL = fmt.Sprintf("%s://%s%s", StringValue(request.Protocol), StringValue(request.Domain), StringValue(request.Pathname))
-	queryParams := request.Query
-	// sort QueryParams by key
-	q := url.Values{}
-	for key, value := range queryParams {
-		q.Add(key, StringValue(value))
-	}
-	querystring := q.Encode()
+}
+
+// buildRequestURL joins protocol, domain, pathname and query of a normalized request
+func buildRequestURL(request *Request) string {
+	requestURL := fmt.Sprintf("%s://%s%s", StringValue(request.Protocol), StringValue(request.Domain), StringValue(request.Pathname))
+	querystring := request.encodeQuery()
 	if len(querystring) > 0 {
 		if strings.Contains(requestURL, "?") {
 			requestURL = fmt.Sprintf("%s&%s", requestURL, querystring)
@@ -418,58 +523,98 @@ func DoRequestWithCtx(ctx context.Context, request *Request, runtimeObject *Runt
 			requestURL = fmt.Sprintf("%s?%s", requestURL, querystring)
 		}
 	}
-	debugLog("> %s %s", StringValue(request.Method), requestURL)
-
-	httpRequest, err := http.NewRequestWithContext(ctx, StringValue(request.Method), requestURL, request.Body)
-	if err != nil {
-		return
-	}
-	httpRequest.Host = StringValue(request.Domain)
+	return requestURL
+}
 
-	var client HttpClient
-	if runtimeObject.HttpClient == nil {
-		client = getDaraClient(runtimeObject.getClientTag(StringValue(request.Domain)))
-	} else {
-		client = runtimeObject.HttpClient
+// prepareTransport returns the client and the pooled transport the request is sent with
+func prepareTransport(request *Request, runtimeObject *RuntimeObject) (HttpClient, *http.Transport, error) {
+	if err := setProxyAuthorization(request, runtimeObject); err != nil {
+		return nil, nil, err
 	}
-
-	trans, err := getHttpTransport(request, runtimeObject)
+	tag := runtimeObject.getClientTag(StringValue(request.Protocol), StringValue(request.Domain))
+	defaultClient, err := clientPool.get(tag, StringValue(request.Domain), func() (*http.Transport, error) {
+		return getHttpTransport(request, runtimeObject)
+	})
 	if err != nil {
-		return
+		return nil, nil, err
 	}
-	if defaultClient, ok := client.(*daraClient); ok {
-		defaultClient.Lock()
-		if !defaultClient.ifInit || defaultClient.httpClient.Transport == nil {
-			defaultClient.httpClient.Transport = trans
-		}
-		defaultClient.httpClient.Timeout = time.Duration(IntValue(runtimeObject.ReadTimeout)) * time.Millisecond
-		defaultClient.ifInit = true
-		defaultClient.Unlock()
+	trans := defaultClient.httpClient.Transport.(*http.Transport)
+	if runtimeObject.HttpClient != nil {
+		return runtimeObject.HttpClient, trans, nil
 	}
+	return defaultClient, trans, nil
+}
 
+// setRequestHeaders copies the request headers to the http request
+func setRequestHeaders(httpRequest *http.Request, request *Request) {
+	redaction := utils.GetDebugRedactionPolicy()
 	for key, value := range request.Headers {
 		if value == nil || key == "content-length" {
 			continue
-		} else if key == "host" {
-			httpRequest.Header["Host"] = []string{*value}
-			delete(httpRequest.Header, "host")
-		} else if key == "user-agent" {
-			httpRequest.Header["User-Agent"] = []string{*value}
-			delete(httpRequest.Header, "user-agent")
-		} else {
-			httpRequest.Header[key] = []string{*value}
 		}
-		debugLog("> %s: %s", key, StringValue(value))
+		httpRequest.Header[httpHeaderKey(key)] = []string{*value}
+		debugLog("> %s: %s", key, redaction.RedactHeader(key, StringValue(value)))
+	}
+	for key, values := range request.HeaderValues {
+		if len(values) == 0 || key == "content-length" {
+			continue
+		}
+		httpRequest.Header[httpHeaderKey(key)] = append([]string(nil), values...)
+		for _, value := range values {
+			debugLog("> %s: %s", key, redaction.RedactHeader(key, value))
+		}
+	}
+}
+
+// httpHeaderKey returns the key a request header is stored under in http.Header
+func httpHeaderKey(key string) string {
+	switch key {
+	case "host":
+		return "Host"
+	case "user-agent":
+		return "User-Agent"
 	}
+	return key
+}
+
+// sendRequest runs the interceptors and the client, publishing progress events
+func sendRequest(ctx context.Context, httpRequest *http.Request, client HttpClient, trans *http.Transport,
+	request *Request, runtimeObject *RuntimeObject, record *utils.LogRecord) (*http.Response, error) {
 	contentlength, _ := strconv.Atoi(StringValue(request.Headers["content-length"]))
 	event := utils.NewProgressEvent(utils.TransferStartedEvent, 0, int64(contentlength), 0)
 	utils.PublishProgress(runtimeObject.Listener, event)
 
-	putMsgToMap(fieldMap, httpRequest)
+	putMsgToRecord(record, httpRequest)
+	wait, release, err := acquireLimits(ctx, httpRequest.Host, runtimeObject)
+	defer release()
+	record.Wait = wait
+	if err != nil {
+		event = utils.NewProgressEvent(utils.TransferFailedEvent, 0, int64(contentlength), 0)
+		utils.PublishProgress(runtimeObject.Listener, event)
+		// a request given up while held by a limiter fails as it would while being sent
+		return nil, ClassifyTransportError(ctx, TeaSDKError(err))
+	}
+	breaker := runtimeObject.CircuitBreaker
+	if breaker != nil {
+		if err := breaker.allow(httpRequest.Host); err != nil {
+			event = utils.NewProgressEvent(utils.TransferFailedEvent, 0, int64(contentlength), 0)
+			utils.PublishProgress(runtimeObject.Listener, event)
+			return nil, err
+		}
+	}
 	startTime := time.Now()
-	fieldMap["{start_time}"] = startTime.Format("2006-01-02 15:04:05")
-	res, err := hookDo(client.Call)(httpRequest, trans)
-	fieldMap["{cost}"] = time.Since(startTime).String()
+	record.StartTime = startTime
+	send := func(req *http.Request) (*http.Response, error) {
+		// only the failures of the exchange with the server are transport errors, those of
+		// the configuration or of the interceptors are returned as is
+		res, err := hookDo(client.Call)(req, trans)
+		return res, ClassifyTransportError(ctx, err)
+	}
+	res, err := chainInterceptors(runtimeObject.Interceptors, send)(httpRequest)
+	record.Cost = time.Since(startTime)
+	if breaker != nil {
+		breaker.done(httpRequest.Host, circuitOutcomeOf(ctx, res, err))
+	}
 	completedBytes := int64(0)
 	if runtimeObject.Tracker != nil {
 		completedBytes = runtimeObject.Tracker.CompletedBytes
@@ -477,29 +622,37 @@ func DoRequestWithCtx(ctx context.Context, request *Request, runtimeObject *Runt
 	if err != nil {
 		select {
 		case <-ctx.Done():
-			err = TeaSDKError(ctx.Err())
+			err = ClassifyTransportError(ctx, TeaSDKError(ctx.Err()))
 		default:
 		}
 
 		event = utils.NewProgressEvent(utils.TransferFailedEvent, completedBytes, int64(contentlength), 0)
 		utils.PublishProgress(runtimeObject.Listener, event)
-		return
+		return nil, err
 	}
 
 	event = utils.NewProgressEvent(utils.TransferCompletedEvent, completedBytes, int64(contentlength), 0)
 	utils.PublishProgress(runtimeObject.Listener, event)
+	return res, nil
+}
 
-	response = NewResponse(res)
-	fieldMap["{code}"] = strconv.Itoa(res.StatusCode)
-	fieldMap["{res_headers}"] = Stringify(res.Header)
-	debugLog("< HTTP/1.1 %s", res.Status)
-	for key, value := range res.Header {
-		debugLog("< %s: %s", key, strings.Join(value, ""))
-		if len(value) != 0 {
-			response.Headers[strings.ToLower(key)] = String(value[0])
+// decodeResponse wraps the http response and collects its headers
+func decodeResponse(res *http.Response, record *utils.LogRecord) *Response {
+	response := NewResponse(res)
+	record.StatusCode = res.StatusCode
+	record.ResponseHeaders = res.Header
+	if res.Proto != "" {
+		record.Version = strings.TrimPrefix(res.Proto, "HTTP/")
+	}
+	record.RequestId = StringValue(response.Headers["x-acs-request-id"])
+	debugLog("< %s %s", res.Proto, res.Status)
+	redaction := utils.GetDebugRedactionPolicy()
+	for key, values := range res.Header {
+		for _, value := range values {
+			debugLog("< %s: %s", key, redaction.RedactHeader(key, value))
 		}
 	}
-	return
+	return response
 }
 
 func getHttpTransport(req *Request, runtime *RuntimeObject) (*http.Transport, error) {
@@ -536,12 +689,6 @@ func getHttpTransport(req *Request, runtime *RuntimeObject) (*http.Transport, er
 	}
 	if httpProxy != nil {
 		trans.Proxy = http.ProxyURL(httpProxy)
-		if httpProxy.User != nil {
-			password, _ := httpProxy.User.Password()
-			auth := httpProxy.User.Username() + ":" + password
-			basic := "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
-			req.Headers["Proxy-Authorization"] = String(basic)
-		}
 	}
 	if runtime.Socks5Proxy != nil && StringValue(runtime.Socks5Proxy) != "" {
 		socks5Proxy, err := getSocks5Proxy(runtime)
@@ -578,19 +725,94 @@ func getHttpTransport(req *Request, runtime *RuntimeObject) (*http.Transport, er
 	if runtime.IdleTimeout != nil && *runtime.IdleTimeout > 0 {
 		trans.IdleConnTimeout = time.Duration(IntValue(runtime.IdleTimeout)) * time.Millisecond
 	}
+	if runtime.TLSHandshakeTimeout != nil && *runtime.TLSHandshakeTimeout > 0 {
+		trans.TLSHandshakeTimeout = time.Duration(IntValue(runtime.TLSHandshakeTimeout)) * time.Millisecond
+	}
+	if runtime.ResponseHeaderTimeout != nil && *runtime.ResponseHeaderTimeout > 0 {
+		trans.ResponseHeaderTimeout = time.Duration(IntValue(runtime.ResponseHeaderTimeout)) * time.Millisecond
+	}
+	if runtime.ExpectContinueTimeout != nil && *runtime.ExpectContinueTimeout > 0 {
+		trans.ExpectContinueTimeout = time.Duration(IntValue(runtime.ExpectContinueTimeout)) * time.Millisecond
+	}
+	if StringValue(runtime.HttpVersion) == HttpVersionH2C && httpProxy != nil && strings.ToLower(*req.Protocol) == "http" {
+		// the h2c connections are dialed straight to the server
+		return nil, fmt.Errorf("http version %q can not be used through an http proxy", HttpVersionH2C)
+	}
+	if err := configureHttpVersion(trans, StringValue(runtime.HttpVersion)); err != nil {
+		return nil, err
+	}
 	return trans, nil
 }
 
-func putMsgToMap(fieldMap map[string]string, request *http.Request) {
-	fieldMap["{host}"] = request.Host
-	fieldMap["{method}"] = request.Method
-	fieldMap["{uri}"] = request.URL.RequestURI()
-	fieldMap["{pid}"] = strconv.Itoa(os.Getpid())
-	fieldMap["{version}"] = strings.Split(request.Proto, "/")[1]
-	hostname, _ := os.Hostname()
-	fieldMap["{hostname}"] = hostname
-	fieldMap["{req_headers}"] = Stringify(request.Header)
-	fieldMap["{target}"] = request.URL.Path + request.URL.RawQuery
+// configureHttpVersion sets up the protocols the transport negotiates
+func configureHttpVersion(trans *http.Transport, version string) error {
+	switch version {
+	case "":
+		return nil
+	case HttpVersion11:
+		trans.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		return nil
+	case HttpVersion2, HttpVersionH2C:
+		h2Trans, err := http2.ConfigureTransports(trans)
+		if err != nil {
+			return err
+		}
+		if version == HttpVersionH2C {
+			trans.RegisterProtocol("http", newH2CTransport(trans, h2Trans))
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported http version %q", version)
+}
+
+// newH2CTransport speaks HTTP/2 without TLS over the connections dialed by trans
+func newH2CTransport(trans *http.Transport, h2Trans *http2.Transport) *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			if trans.DialContext != nil {
+				return trans.DialContext(ctx, network, addr)
+			}
+			return trans.Dial(network, addr)
+		},
+		ReadIdleTimeout: h2Trans.ReadIdleTimeout,
+	}
+}
+
+// setProxyAuthorization adds the basic credentials of the http proxy to the request headers
+func setProxyAuthorization(req *Request, runtime *RuntimeObject) error {
+	httpProxy, err := getHttpProxy(StringValue(req.Protocol), StringValue(req.Domain), runtime)
+	if err != nil {
+		return err
+	}
+	if httpProxy != nil && httpProxy.User != nil {
+		password, _ := httpProxy.User.Password()
+		auth := httpProxy.User.Username() + ":" + password
+		basic := "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
+		req.Headers["Proxy-Authorization"] = String(basic)
+	}
+	return nil
+}
+
+func putMsgToRecord(record *utils.LogRecord, request *http.Request) {
+	record.Host = request.Host
+	record.Method = request.Method
+	record.URI = request.URL.RequestURI()
+	record.Pid = os.Getpid()
+	record.Version = strings.TrimPrefix(request.Proto, "HTTP/")
+	record.Hostname, _ = os.Hostname()
+	record.RequestHeaders = request.Header
+	record.Target = request.URL.Path + request.URL.RawQuery
+}
+
+// logRequest hands the record to the template and the structured loggers of the runtime
+func logRequest(runtimeObject *RuntimeObject, record *utils.LogRecord) {
+	if runtimeObject.Logger != nil {
+		runtimeObject.Logger.LogRequest(record)
+	}
+	if runtimeObject.StructuredLogger != nil {
+		runtimeObject.StructuredLogger.LogRequest(record)
+	}
 }
 
 func getNoProxy(protocol string, runtime *RuntimeObject) []string {
@@ -709,13 +931,13 @@ func setDialContext(runtime *RuntimeObject) func(cxt context.Context, net, addr
 				IP: []byte(StringValue(runtime.LocalAddr)),
 			}
 			return (&net.Dialer{
-				Timeout:   time.Duration(IntValue(runtime.ConnectTimeout)) * time.Second,
+				Timeout:   time.Duration(IntValue(runtime.ConnectTimeout)) * time.Millisecond,
 				DualStack: true,
 				LocalAddr: netAddr,
 			}).DialContext(ctx, network, address)
 		}
 		return (&net.Dialer{
-			Timeout:   time.Duration(IntValue(runtime.ConnectTimeout)) * time.Second,
+			Timeout:   time.Duration(IntValue(runtime.ConnectTimeout)) * time.Millisecond,
 			DualStack: true,
 		}).DialContext(ctx, network, address)
 	}
@@ -6,16 +6,21 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/alibabacloud-go/tea/utils"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var runtimeObj = map[string]interface{}{
@@ -911,6 +916,375 @@ func Test_DoRequestWithConcurrentAndContext(t *testing.T) {
 	wg.Wait()
 }
 
+func Test_DoRequestWithReadTimeoutConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	timedOut, succeeded := 0, 0
+	for i := 0; i < 20; i++ {
+		for _, readTimeout := range []int{50, 5000} {
+			wg.Add(1)
+			go func(readTimeout int) {
+				defer wg.Done()
+				request := NewRequest()
+				request.Headers["host"] = String(host)
+				runtime := &RuntimeObject{ReadTimeout: Int(readTimeout), NoProxy: String(host)}
+				resp, err := DoRequest(request, runtime)
+				mu.Lock()
+				defer mu.Unlock()
+				if readTimeout == 50 {
+					if err != nil {
+						timedOut++
+					}
+					return
+				}
+				if err == nil {
+					body, err := resp.ReadBody()
+					if err == nil && string(body) == "ok" {
+						succeeded++
+					}
+				}
+			}(readTimeout)
+		}
+	}
+	wg.Wait()
+	utils.AssertEqual(t, 20, timedOut)
+	utils.AssertEqual(t, 20, succeeded)
+
+	// requests with different read timeouts share one pooled client which is never mutated
+	request := NewRequest()
+	request.Headers["host"] = String(host)
+	normalizeRequest(request)
+	client, _, err := prepareTransport(request, &RuntimeObject{ReadTimeout: Int(50), NoProxy: String(host)})
+	utils.AssertNil(t, err)
+	other, _, err := prepareTransport(request, &RuntimeObject{ReadTimeout: Int(5000), NoProxy: String(host)})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, client == other)
+	utils.AssertEqual(t, time.Duration(0), client.(*daraClient).httpClient.Timeout)
+}
+
+func Test_getHttpTransportTimeouts(t *testing.T) {
+	request := NewRequest()
+	request.Protocol = String("https")
+	normalizeRequest(request)
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"idleTimeout":           1000,
+		"tlsHandshakeTimeout":   2000,
+		"responseHeaderTimeout": 3000,
+		"expectContinueTimeout": 4000,
+	})
+	trans, err := getHttpTransport(request, runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, time.Second, trans.IdleConnTimeout)
+	utils.AssertEqual(t, 2*time.Second, trans.TLSHandshakeTimeout)
+	utils.AssertEqual(t, 3*time.Second, trans.ResponseHeaderTimeout)
+	utils.AssertEqual(t, 4*time.Second, trans.ExpectContinueTimeout)
+}
+
+func Test_DoRequestWithBodyIdleTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	request := NewRequest()
+	request.Headers["host"] = String(host)
+	runtime := &RuntimeObject{BodyIdleTimeout: Int(100), NoProxy: String(host)}
+	start := time.Now()
+	resp, err := DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	body, err := resp.ReadBody()
+	utils.AssertNil(t, body)
+	utils.AssertContains(t, err.Error(), "read response body timeout: no data received for 100ms")
+	utils.AssertEqual(t, "ReadTimeoutError", StringValue(err.(BaseError).GetName()))
+	utils.AssertEqual(t, true, time.Since(start) < 3*time.Second)
+}
+
+func Test_idleTimeoutBody(t *testing.T) {
+	cancelled := false
+	body := newIdleTimeoutBody(ioutil.NopCloser(strings.NewReader("data")), 50*time.Millisecond, func() {
+		cancelled = true
+	})
+	// the timer only runs while a read is waiting for data
+	time.Sleep(100 * time.Millisecond)
+	byt, err := ioutil.ReadAll(body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "data", string(byt))
+	utils.AssertNil(t, body.Close())
+	utils.AssertEqual(t, false, cancelled)
+}
+
+// slowReader returns one byte of data after every delay
+type slowReader struct {
+	data  string
+	delay time.Duration
+}
+
+func (reader *slowReader) Read(p []byte) (int, error) {
+	if reader.data == "" {
+		return 0, io.EOF
+	}
+	time.Sleep(reader.delay)
+	p[0] = reader.data[0]
+	reader.data = reader.data[1:]
+	return 1, nil
+}
+
+func Test_idleTimeoutBodyReadsUnderTimeout(t *testing.T) {
+	var cancelled int32
+	cancel := func() {
+		atomic.StoreInt32(&cancelled, 1)
+	}
+	// every read takes a little less than the idle timeout
+	body := newIdleTimeoutBody(ioutil.NopCloser(&slowReader{data: "data", delay: 80 * time.Millisecond}), 100*time.Millisecond, cancel)
+	byt, err := ioutil.ReadAll(body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "data", string(byt))
+	utils.AssertEqual(t, int32(0), atomic.LoadInt32(&cancelled))
+
+	// a timer firing once its read returned does not cancel the stream
+	body.expire(body.reads)
+	utils.AssertEqual(t, int32(0), atomic.LoadInt32(&cancelled))
+	utils.AssertEqual(t, false, body.expired)
+
+	// a read blocked for longer does
+	body = newIdleTimeoutBody(ioutil.NopCloser(&slowReader{data: "data", delay: 200 * time.Millisecond}), 50*time.Millisecond, cancel)
+	_, err = body.Read(make([]byte, 4))
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, int32(1), atomic.LoadInt32(&cancelled))
+	utils.AssertEqual(t, true, body.expired)
+}
+
+func Test_DoRequestWithHttpVersion(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	tlsHost := strings.TrimPrefix(tlsServer.URL, "https://")
+
+	h2cServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer h2cServer.Close()
+	h2cHost := strings.TrimPrefix(h2cServer.URL, "http://")
+
+	tests := []struct {
+		protocol string
+		host     string
+		version  string
+		proto    string
+	}{
+		{"https", tlsHost, "", "HTTP/1.1"},
+		{"https", tlsHost, HttpVersion11, "HTTP/1.1"},
+		{"https", tlsHost, HttpVersion2, "HTTP/2.0"},
+		{"https", tlsHost, HttpVersionH2C, "HTTP/2.0"},
+		{"http", h2cHost, HttpVersion2, "HTTP/1.1"},
+		{"http", h2cHost, HttpVersionH2C, "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		request := NewRequest()
+		request.Protocol = String(tt.protocol)
+		request.Headers["host"] = String(tt.host)
+		logger := utils.NewLogger("info", "", &bytes.Buffer{}, "{version}")
+		runtime := &RuntimeObject{
+			IgnoreSSL:   Bool(true),
+			NoProxy:     String(tt.host),
+			HttpVersion: String(tt.version),
+			Logger:      logger,
+		}
+		resp, err := DoRequest(request, runtime)
+		utils.AssertNil(t, err)
+		body, err := resp.ReadBody()
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, tt.proto, string(body))
+		utils.AssertEqual(t, tt.proto, StringValue(resp.Proto))
+		utils.AssertEqual(t, strings.TrimPrefix(tt.proto, "HTTP/"), logger.GetLastLogMsg())
+	}
+
+	request := NewRequest()
+	request.Headers["host"] = String(h2cHost)
+	_, err := DoRequest(request, &RuntimeObject{HttpVersion: String("HTTP/3")})
+	utils.AssertEqual(t, `unsupported http version "HTTP/3"`, err.Error())
+
+	// h2c does not go through an http proxy
+	_, err = DoRequest(request, &RuntimeObject{HttpVersion: String(HttpVersionH2C), HttpProxy: String("http://127.0.0.1:1")})
+	utils.AssertEqual(t, `http version "h2c" can not be used through an http proxy`, err.Error())
+}
+
+type recordingLogger struct {
+	sync.Mutex
+	records []*utils.LogRecord
+}
+
+func (logger *recordingLogger) LogRequest(record *utils.LogRecord) {
+	logger.Lock()
+	defer logger.Unlock()
+	logger.records = append(logger.records, record)
+}
+
+func (logger *recordingLogger) list() []*utils.LogRecord {
+	logger.Lock()
+	defer logger.Unlock()
+	return append([]*utils.LogRecord(nil), logger.records...)
+}
+
+func Test_DoRequestWithStructuredLogger(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			res, err := mockResponse(503, ``, nil)
+			res.Header.Set("x-acs-request-id", "req-1")
+			return res, err
+		}
+	}
+
+	structured := &recordingLogger{}
+	buffer := new(bytes.Buffer)
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"structuredLogger": structured,
+		"logger":           utils.NewLogger("info", "", buffer, `{method} {host} {code} {version}`),
+	})
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	_, err := DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 1, len(structured.records))
+	record := structured.records[0]
+	utils.AssertEqual(t, "POST", record.Method)
+	utils.AssertEqual(t, "ecs.aliyuncs.com", record.Host)
+	utils.AssertEqual(t, 503, record.StatusCode)
+	utils.AssertEqual(t, "req-1", record.RequestId)
+	utils.AssertEqual(t, true, record.Cost >= 0)
+	utils.AssertEqual(t, false, record.StartTime.IsZero())
+	utils.AssertNil(t, record.Error)
+	utils.AssertEqual(t, "POST ecs.aliyuncs.com 503 1.1", runtime.Logger.GetLastLogMsg())
+
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			return nil, errors.New("Internal error")
+		}
+	}
+	_, err = DoRequest(request, runtime)
+	utils.AssertEqual(t, err, structured.records[1].Error)
+	utils.AssertEqual(t, "error", structured.records[1].Level())
+}
+
+func Test_DoRequestLogsRedactedError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	utils.AssertNil(t, err)
+	host := listener.Addr().String()
+	listener.Close()
+
+	buffer := new(bytes.Buffer)
+	jsonBuffer := new(bytes.Buffer)
+	runtime := &RuntimeObject{
+		NoProxy:          String(host),
+		Logger:           utils.NewLogger("info", "", buffer, "{error}"),
+		StructuredLogger: utils.NewJSONLogger(jsonBuffer),
+	}
+	request := NewRequest()
+	request.Headers["host"] = String(host)
+	request.Query["SecurityToken"] = String("SECRET")
+	_, err = DoRequest(request, runtime)
+	utils.AssertContains(t, err.Error(), "SecurityToken=SECRET")
+	utils.AssertContains(t, runtime.Logger.GetLastLogMsg(), "SecurityToken=***", "connection refused")
+	utils.AssertEqual(t, false, strings.Contains(runtime.Logger.GetLastLogMsg(), "SECRET"))
+	utils.AssertContains(t, jsonBuffer.String(), `"error":`, "SecurityToken=***")
+	utils.AssertEqual(t, false, strings.Contains(jsonBuffer.String(), "SECRET"))
+}
+
+func Test_normalizeRequest(t *testing.T) {
+	request := NewRequest()
+	request.Protocol = String("HTTPS")
+	request.Port = Int(8080)
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	normalizeRequest(request)
+	utils.AssertEqual(t, "GET", StringValue(request.Method))
+	utils.AssertEqual(t, "https", StringValue(request.Protocol))
+	utils.AssertEqual(t, "ecs.aliyuncs.com:8080", StringValue(request.Domain))
+}
+
+func Test_buildRequestURL(t *testing.T) {
+	request := NewRequest()
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	request.Pathname = String("/path")
+	normalizeRequest(request)
+	utils.AssertEqual(t, "http://ecs.aliyuncs.com/path", buildRequestURL(request))
+
+	request.Query["b"] = String("2")
+	request.Query["a"] = String("1")
+	utils.AssertEqual(t, "http://ecs.aliyuncs.com/path?a=1&b=2", buildRequestURL(request))
+
+	request.Pathname = String("/path?log")
+	utils.AssertEqual(t, "http://ecs.aliyuncs.com/path?log&a=1&b=2", buildRequestURL(request))
+
+	request.Pathname = String("/path")
+	request.Query["a"] = String("x y")
+	request.QueryParams = []*QueryParam{{Key: "b", Value: String("3")}}
+	utils.AssertEqual(t, "http://ecs.aliyuncs.com/path?a=x%20y&b=2&b=3", buildRequestURL(request))
+}
+
+func Test_setRequestHeaders(t *testing.T) {
+	httpRequest, _ := http.NewRequest("GET", "http://ecs.aliyuncs.com", nil)
+	request := NewRequest()
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	request.Headers["user-agent"] = String("tea")
+	request.Headers["content-length"] = String("10")
+	request.Headers["x-acs-action"] = String("Describe")
+	request.Headers["empty"] = nil
+	setRequestHeaders(httpRequest, request)
+	utils.AssertEqual(t, []string{"ecs.aliyuncs.com"}, httpRequest.Header["Host"])
+	utils.AssertEqual(t, []string{"tea"}, httpRequest.Header["User-Agent"])
+	utils.AssertEqual(t, []string{"Describe"}, httpRequest.Header["x-acs-action"])
+	utils.AssertEqual(t, 3, len(httpRequest.Header))
+
+	request.HeaderValues["x-acs-action"] = []string{"Describe", "List"}
+	request.HeaderValues["accept"] = []string{"application/json", "text/xml"}
+	request.HeaderValues["content-length"] = []string{"10"}
+	request.HeaderValues["skipped"] = []string{}
+	setRequestHeaders(httpRequest, request)
+	utils.AssertEqual(t, []string{"Describe", "List"}, httpRequest.Header["x-acs-action"])
+	utils.AssertEqual(t, []string{"application/json", "text/xml"}, httpRequest.Header["accept"])
+	utils.AssertEqual(t, 4, len(httpRequest.Header))
+}
+
+func Test_decodeResponse(t *testing.T) {
+	res, _ := mockResponse(404, `not found`, nil)
+	res.Header.Set("X-Acs-Request-Id", "abc")
+	record := &utils.LogRecord{}
+	response := decodeResponse(res, record)
+	utils.AssertEqual(t, 404, IntValue(response.StatusCode))
+	utils.AssertEqual(t, "404 Not Found", StringValue(response.StatusMessage))
+	utils.AssertEqual(t, "test", StringValue(response.Headers["tea"]))
+	utils.AssertEqual(t, "abc", StringValue(response.Headers["x-acs-request-id"]))
+	utils.AssertEqual(t, 404, record.StatusCode)
+	utils.AssertEqual(t, "abc", record.RequestId)
+	utils.AssertEqual(t, "1.1", record.Version)
+
+	res, _ = mockResponse(200, ``, nil)
+	res.Header.Add("Set-Cookie", "a=1")
+	res.Header.Add("Set-Cookie", "b=2")
+	response = decodeResponse(res, record)
+	utils.AssertEqual(t, "a=1", StringValue(response.Headers["set-cookie"]))
+	utils.AssertEqual(t, []string{"a=1", "b=2"}, response.HeaderValues["set-cookie"])
+	utils.AssertEqual(t, []string{"test"}, response.HeaderValues["tea"])
+}
+
 func Test_getHttpProxy(t *testing.T) {
 	originHttpProxy := os.Getenv("HTTP_PROXY")
 	originHttpsProxy := os.Getenv("HTTPS_PROXY")
@@ -37,6 +37,19 @@ type SDKError struct {
 	errMsg             *string
 	Description        *string
 	AccessDeniedDetail map[string]interface{}
+	// RetryAfter is the delay in milliseconds the server asked to wait before retrying
+	RetryAfter *int64
+	// RateLimit holds the x-ratelimit-* headers of the response
+	RateLimit *RateLimit
+	// RequestId is the id the server gave to the failed request
+	RequestId *string
+	// Recommend is the link to the diagnosis the server recommends, if any
+	Recommend *string
+	// Headers holds the headers of the response, with lower-cased keys
+	Headers map[string]*string
+	// Cause is the error the SDKError was created from, returned by Unwrap
+	Cause error
+	data  map[string]interface{}
 }
 
 // CastError is used for cast type fails
@@ -57,6 +70,7 @@ func TeaSDKError(err error) error {
 			"data": te.Data,
 			"description": StringValue(te.Description),
 			"accessDeniedDetail": te.AccessDeniedDetail,
+			"cause": err,
 		})
 	}
 
@@ -68,6 +82,7 @@ func TeaSDKError(err error) error {
 			"description": StringValue(respErr.GetDescription()),
 			"data": respErr.GetData(),
 			"accessDeniedDetail": respErr.GetAccessDeniedDetail(),
+			"cause": err,
 		})
 	}
 
@@ -75,12 +90,41 @@ func TeaSDKError(err error) error {
 		return tea.NewSDKError(map[string]interface{}{
 			"code": StringValue(baseErr.GetCode()),
 			"message": baseErr.Error(),
+			"cause": err,
 		})
 	}
 
 	return err
 }
 
+// FromTeaSDKError converts a tea.SDKError back to an SDKError, keeping its cause,
+// the SDKError a tea.SDKError was converted from by TeaSDKError is returned as is.
+// Any other error is returned unchanged.
+func FromTeaSDKError(err error) error {
+	te, ok := err.(*tea.SDKError)
+	if !ok {
+		return err
+	}
+	if original, ok := te.Cause.(*SDKError); ok {
+		return original
+	}
+	result := NewSDKError(map[string]interface{}{
+		"code":               StringValue(te.Code),
+		"statusCode":         IntValue(te.StatusCode),
+		"message":            StringValue(te.Message),
+		"description":        StringValue(te.Description),
+		"accessDeniedDetail": te.AccessDeniedDetail,
+		"cause":              te.Cause,
+	})
+	result.Data = te.Data
+	result.data = decodeErrorData(te.Data)
+	result.Stack = te.Stack
+	if requestId := result.data["RequestId"]; requestId != nil && result.RequestId == nil {
+		result.RequestId = String(fmt.Sprint(requestId))
+	}
+	return result
+}
+
 // NewSDKError is used for shortly create SDKError object
 func NewSDKError(obj map[string]interface{}) *SDKError {
 	err := &SDKError{}
@@ -133,12 +177,16 @@ func NewSDKError(obj map[string]interface{}) *SDKError {
 					err.StatusCode = code
 				}
 			}
+			err.data = res
 		}
 		byt := bytes.NewBuffer([]byte{})
 		jsonEncoder := json.NewEncoder(byt)
 		jsonEncoder.SetEscapeHTML(false)
 		jsonEncoder.Encode(data)
 		err.Data = String(string(bytes.TrimSpace(byt.Bytes())))
+		if err.data == nil {
+			err.data = decodeErrorData(err.Data)
+		}
 	}
 
 	if statusCode, ok := obj["statusCode"].(int); ok {
@@ -150,6 +198,52 @@ func NewSDKError(obj map[string]interface{}) *SDKError {
 		}
 	}
 
+	// "headers" takes the headers of the Response, "retryAfter" a delay in milliseconds
+	now := SystemClock.Now()
+	headers := normalizeHeaders(obj["headers"])
+	if len(headers) > 0 {
+		err.Headers = make(map[string]*string, len(headers))
+		for key, value := range headers {
+			err.Headers[key] = String(value)
+		}
+	}
+	err.RateLimit = ParseRateLimit(headers, now)
+	err.RetryAfter = retryAfterFromHeaders(headers, err.RateLimit, now)
+	switch retryAfter := obj["retryAfter"].(type) {
+	case int:
+		err.RetryAfter = Int64(int64(retryAfter))
+	case int64:
+		err.RetryAfter = Int64(retryAfter)
+	case *int64:
+		err.RetryAfter = retryAfter
+	case string:
+		if delay, ok := ParseRetryAfter(retryAfter, now); ok {
+			err.RetryAfter = Int64(delay)
+		}
+	}
+
+	// "requestId" wins over the RequestId of the data and the request id header
+	if requestId, ok := obj["requestId"].(string); ok {
+		err.RequestId = String(requestId)
+	} else if requestId := err.data["RequestId"]; requestId != nil {
+		err.RequestId = String(fmt.Sprint(requestId))
+	} else if requestId := err.data["requestId"]; requestId != nil {
+		err.RequestId = String(fmt.Sprint(requestId))
+	} else if requestId, ok := headers["x-acs-request-id"]; ok {
+		err.RequestId = String(requestId)
+	}
+
+	if recommend, ok := obj["recommend"].(string); ok {
+		err.Recommend = String(recommend)
+	}
+
+	if cause, ok := obj["cause"].(error); ok {
+		err.Cause = cause
+		if err.Message == nil {
+			err.Message = String(cause.Error())
+		}
+	}
+
 	return err
 }
 
@@ -165,6 +259,93 @@ func (err *SDKError) GetCode() *string {
 	return err.Code
 }
 
+func (err *SDKError) GetName() *string {
+	return err.Name
+}
+
+// GetRetryAfter returns the delay in milliseconds the server asked to wait before retrying
+func (err *SDKError) GetRetryAfter() *int64 {
+	return err.RetryAfter
+}
+
+func (err *SDKError) GetStatusCode() *int {
+	return err.StatusCode
+}
+
+func (err *SDKError) GetAccessDeniedDetail() map[string]interface{} {
+	return err.AccessDeniedDetail
+}
+
+func (err *SDKError) GetDescription() *string {
+	return err.Description
+}
+
+// GetData returns the data the error was created with, decoding Data when it was set directly.
+// It never modifies the error, which may be shared by goroutines.
+func (err *SDKError) GetData() map[string]interface{} {
+	if err.data != nil {
+		return err.data
+	}
+	return decodeErrorData(err.Data)
+}
+
+// decodeErrorData decodes the JSON object of Data, nil when it is not one
+func decodeErrorData(data *string) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	result := make(map[string]interface{})
+	if json.Unmarshal([]byte(StringValue(data)), &result) != nil {
+		return nil
+	}
+	return result
+}
+
+// GetRequestId returns the id the server gave to the failed request
+func (err *SDKError) GetRequestId() *string {
+	return err.RequestId
+}
+
+// GetRecommend returns the link to the diagnosis the server recommends
+func (err *SDKError) GetRecommend() *string {
+	return err.Recommend
+}
+
+// GetHeaders returns the headers of the response, with lower-cased keys
+func (err *SDKError) GetHeaders() map[string]*string {
+	return err.Headers
+}
+
+// Unwrap returns the error the SDKError was created from
+func (err *SDKError) Unwrap() error {
+	return err.Cause
+}
+
+// Is reports whether target is an SDKError, or a tea.SDKError, used as a sentinel:
+// the Code and StatusCode it sets, at least one of them, must match those of err.
+//
+//	var ErrThrottling = &dara.SDKError{Code: dara.String("Throttling")}
+//	errors.Is(err, ErrThrottling)
+func (err *SDKError) Is(target error) bool {
+	var code *string
+	var statusCode *int
+	switch t := target.(type) {
+	case *SDKError:
+		code, statusCode = t.Code, t.StatusCode
+	case *tea.SDKError:
+		code, statusCode = t.Code, t.StatusCode
+	default:
+		return false
+	}
+	if code == nil && statusCode == nil {
+		return false
+	}
+	if code != nil && StringValue(err.Code) != *code {
+		return false
+	}
+	return statusCode == nil || IntValue(err.StatusCode) == *statusCode
+}
+
 // Set ErrMsg by msg
 func (err *SDKError) SetErrMsg(msg string) {
 	err.errMsg = String(msg)
@@ -0,0 +1,152 @@
+package dara
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	v2 "github.com/clbanning/mxj/v2"
+)
+
+// ErrorBodyLimit caps the bytes NewSDKErrorFromResponse reads from the body of a response
+const ErrorBodyLimit = 64 * 1024
+
+// the spellings of the fields of the error bodies, in the order they are looked up
+var (
+	errorCodeFields          = []string{"Code", "code", "ErrorCode", "errorCode", "error_code"}
+	errorMessageFields       = []string{"Message", "message", "ErrorMessage", "errorMessage", "errorMsg", "error_message", "msg"}
+	errorRequestIdFields     = []string{"RequestId", "requestId", "RequestID", "request_id"}
+	errorRecommendFields     = []string{"Recommend", "recommend"}
+	errorDescriptionFields   = []string{"Description", "description"}
+	errorAccessDeniedFields  = []string{"AccessDeniedDetail", "accessDeniedDetail"}
+	errorNestedObjectFields  = []string{"Error", "error"}
+	errorRequestIdHeaderKeys = []string{"x-acs-request-id", "x-request-id"}
+)
+
+// NewSDKErrorFromResponse builds the SDKError described by the body of a failed response.
+// At most ErrorBodyLimit bytes are read and the body is closed, the bytes read replace it.
+// A JSON or XML body, told by the Content-Type or else by its first character, gives the
+// code, message, request id, recommend, description and access denied detail, under their
+// common spellings and possibly nested in an "Error" object. The code defaults to the status
+// code and the message to the body, or the status text. The status code and the headers of
+// the response are kept.
+func NewSDKErrorFromResponse(resp *Response) *SDKError {
+	if resp == nil {
+		return nil
+	}
+	return newSDKErrorFromResponse(resp, ErrorBodyLimit)
+}
+
+func newSDKErrorFromResponse(resp *Response, limit int64) *SDKError {
+	statusCode := IntValue(resp.StatusCode)
+	var body []byte
+	if resp.Body != nil {
+		body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	data := parseErrorBody(body, StringValue(resp.Headers["content-type"]))
+	fields := data
+	for _, key := range errorNestedObjectFields {
+		if nested, ok := data[key].(map[string]interface{}); ok {
+			fields = nested
+			break
+		}
+	}
+	lookup := func(keys []string) (string, bool) {
+		for _, m := range []map[string]interface{}{fields, data} {
+			for _, key := range keys {
+				switch value := m[key].(type) {
+				case string:
+					if value != "" {
+						return value, true
+					}
+				case json.Number:
+					return value.String(), true
+				}
+			}
+		}
+		return "", false
+	}
+
+	obj := map[string]interface{}{
+		"statusCode": statusCode,
+		"headers":    resp.Headers,
+	}
+	if code, ok := lookup(errorCodeFields); ok {
+		obj["code"] = code
+	} else {
+		obj["code"] = strconv.Itoa(statusCode)
+	}
+	if message, ok := lookup(errorMessageFields); ok {
+		obj["message"] = message
+	} else if data == nil && len(bytes.TrimSpace(body)) > 0 {
+		obj["message"] = string(bytes.TrimSpace(body))
+	} else {
+		obj["message"] = http.StatusText(statusCode)
+	}
+	if requestId, ok := lookup(errorRequestIdFields); ok {
+		obj["requestId"] = requestId
+	} else {
+		for _, key := range errorRequestIdHeaderKeys {
+			if requestId := StringValue(resp.Headers[key]); requestId != "" {
+				obj["requestId"] = requestId
+				break
+			}
+		}
+	}
+	if description, ok := lookup(errorDescriptionFields); ok {
+		obj["description"] = description
+	}
+	for _, m := range []map[string]interface{}{fields, data} {
+		for _, key := range errorAccessDeniedFields {
+			if detail, ok := m[key].(map[string]interface{}); ok && obj["accessDeniedDetail"] == nil {
+				obj["accessDeniedDetail"] = detail
+			}
+		}
+	}
+	if recommend, ok := lookup(errorRecommendFields); ok {
+		obj["recommend"] = recommend
+	}
+	if data != nil {
+		obj["data"] = data
+	}
+	return NewSDKError(obj)
+}
+
+// parseErrorBody decodes a JSON object or an XML document into a map, nil when the body is neither.
+// The root element of an XML document is left out.
+func parseErrorBody(body []byte, contentType string) map[string]interface{} {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil
+	}
+	contentType = strings.ToLower(contentType)
+	isJSON := strings.Contains(contentType, "json") || (!strings.Contains(contentType, "xml") && trimmed[0] == '{')
+	isXML := strings.Contains(contentType, "xml") || (!strings.Contains(contentType, "json") && trimmed[0] == '<')
+	if isJSON {
+		result := make(map[string]interface{})
+		d := json.NewDecoder(bytes.NewReader(trimmed))
+		d.UseNumber()
+		if d.Decode(&result) == nil {
+			return result
+		}
+	}
+	if isXML {
+		vm, err := v2.NewMapXml(trimmed)
+		if err != nil || len(vm) != 1 {
+			return nil
+		}
+		for _, root := range vm {
+			if result, ok := root.(map[string]interface{}); ok {
+				return result
+			}
+		}
+	}
+	return nil
+}
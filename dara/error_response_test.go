@@ -0,0 +1,107 @@
+package dara
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func newErrorResponse(statusCode int, contentType, body string) *Response {
+	header := http.Header{"X-Acs-Request-Id": []string{"header-request-id"}}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return NewResponse(&http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	})
+}
+
+func TestNewSDKErrorFromResponseJSON(t *testing.T) {
+	resp := newErrorResponse(403, "application/json;charset=utf-8", `{
+		"RequestId": "body-request-id",
+		"Code": "Forbidden.RAM",
+		"Message": "User not authorized",
+		"Recommend": "https://example.com/diagnose",
+		"AccessDeniedDetail": {"AuthAction": "ecs:DescribeInstances", "UserId": 123}
+	}`)
+	err := NewSDKErrorFromResponse(resp)
+	utils.AssertEqual(t, "Forbidden.RAM", StringValue(err.Code))
+	utils.AssertEqual(t, "User not authorized", StringValue(err.Message))
+	utils.AssertEqual(t, "body-request-id", StringValue(err.GetRequestId()))
+	utils.AssertEqual(t, "https://example.com/diagnose", StringValue(err.GetRecommend()))
+	utils.AssertEqual(t, 403, IntValue(err.StatusCode))
+	utils.AssertEqual(t, "ecs:DescribeInstances", err.AccessDeniedDetail["AuthAction"])
+	utils.AssertEqual(t, "header-request-id", StringValue(err.GetHeaders()["x-acs-request-id"]))
+	utils.AssertEqual(t, "Forbidden.RAM", err.GetData()["Code"])
+
+	// the body read is still available
+	body, _ := resp.ReadBody()
+	utils.AssertContains(t, string(body), "Forbidden.RAM")
+
+	// lower-case and nested spellings
+	err = NewSDKErrorFromResponse(newErrorResponse(400, "application/json", `{
+		"error": {"code": 4001, "message": "bad parameter"},
+		"request_id": "snake-request-id"
+	}`))
+	utils.AssertEqual(t, "4001", StringValue(err.Code))
+	utils.AssertEqual(t, "bad parameter", StringValue(err.Message))
+	utils.AssertEqual(t, "snake-request-id", StringValue(err.RequestId))
+
+	err = NewSDKErrorFromResponse(newErrorResponse(429, "", `{"errorCode": "Throttling", "errorMsg": "slow down"}`))
+	utils.AssertEqual(t, "Throttling", StringValue(err.Code))
+	utils.AssertEqual(t, "slow down", StringValue(err.Message))
+	utils.AssertEqual(t, "header-request-id", StringValue(err.RequestId))
+}
+
+func TestNewSDKErrorFromResponseXML(t *testing.T) {
+	err := NewSDKErrorFromResponse(newErrorResponse(404, "text/xml", `<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>NoSuchKey</Code>
+  <Message>The specified key does not exist.</Message>
+  <RequestId>xml-request-id</RequestId>
+  <HostId>bucket.example.com</HostId>
+</Error>`))
+	utils.AssertEqual(t, "NoSuchKey", StringValue(err.Code))
+	utils.AssertEqual(t, "The specified key does not exist.", StringValue(err.Message))
+	utils.AssertEqual(t, "xml-request-id", StringValue(err.RequestId))
+	utils.AssertEqual(t, 404, IntValue(err.StatusCode))
+	utils.AssertEqual(t, "bucket.example.com", err.GetData()["HostId"])
+
+	// sniffed without a content type
+	err = NewSDKErrorFromResponse(newErrorResponse(500, "", `<Error><Code>InternalError</Code></Error>`))
+	utils.AssertEqual(t, "InternalError", StringValue(err.Code))
+	utils.AssertEqual(t, "Internal Server Error", StringValue(err.Message))
+}
+
+func TestNewSDKErrorFromResponseUnstructured(t *testing.T) {
+	err := NewSDKErrorFromResponse(newErrorResponse(502, "text/html", "  <html>bad gateway</html "))
+	utils.AssertEqual(t, "502", StringValue(err.Code))
+	utils.AssertEqual(t, "<html>bad gateway</html", StringValue(err.Message))
+	utils.AssertNil(t, err.GetData())
+
+	err = NewSDKErrorFromResponse(newErrorResponse(503, "application/json", ""))
+	utils.AssertEqual(t, "Service Unavailable", StringValue(err.Message))
+	utils.AssertEqual(t, "header-request-id", StringValue(err.RequestId))
+
+	// the body is read up to the limit
+	resp := newErrorResponse(500, "text/plain", strings.Repeat("a", 100))
+	err = newSDKErrorFromResponse(resp, 10)
+	utils.AssertEqual(t, "aaaaaaaaaa", StringValue(err.Message))
+	body, _ := resp.ReadBody()
+	utils.AssertEqual(t, 10, len(body))
+
+	// a truncated JSON body is kept as text
+	err = newSDKErrorFromResponse(newErrorResponse(500, "application/json", `{"Code": "InternalError"}`), 8)
+	utils.AssertEqual(t, "500", StringValue(err.Code))
+	utils.AssertEqual(t, `{"Code":`, StringValue(err.Message))
+
+	resp = &Response{StatusCode: Int(500)}
+	err = NewSDKErrorFromResponse(resp)
+	utils.AssertEqual(t, "Internal Server Error", StringValue(err.Message))
+	utils.AssertNil(t, NewSDKErrorFromResponse(nil))
+}
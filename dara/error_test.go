@@ -0,0 +1,144 @@
+package dara
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func TestSDKErrorCause(t *testing.T) {
+	cause := &net.DNSError{Err: "no such host", Name: "example.invalid"}
+	err := NewSDKError(map[string]interface{}{
+		"code":  "ServiceUnavailable",
+		"cause": cause,
+	})
+	utils.AssertEqual(t, "lookup example.invalid: no such host", StringValue(err.Message))
+	var dnsErr *net.DNSError
+	utils.AssertEqual(t, true, errors.As(fmt.Errorf("call: %w", err), &dnsErr))
+	utils.AssertEqual(t, cause, dnsErr)
+
+	// the message given wins over the one of the cause
+	err = NewSDKError(map[string]interface{}{
+		"message": "lookup failed",
+		"cause":   cause,
+	})
+	utils.AssertEqual(t, "lookup failed", StringValue(err.Message))
+	utils.AssertNil(t, NewSDKError(map[string]interface{}{"code": "code"}).Unwrap())
+}
+
+func TestSDKErrorIs(t *testing.T) {
+	throttling := &SDKError{Code: String("Throttling")}
+	notFound := &SDKError{StatusCode: Int(404)}
+	err := NewSDKError(map[string]interface{}{
+		"code":       "Throttling",
+		"statusCode": 429,
+	})
+	wrapped := fmt.Errorf("call: %w", err)
+	utils.AssertEqual(t, true, errors.Is(wrapped, throttling))
+	utils.AssertEqual(t, true, errors.Is(wrapped, &SDKError{Code: String("Throttling"), StatusCode: Int(429)}))
+	utils.AssertEqual(t, false, errors.Is(wrapped, &SDKError{Code: String("Throttling"), StatusCode: Int(503)}))
+	utils.AssertEqual(t, false, errors.Is(wrapped, notFound))
+	utils.AssertEqual(t, true, errors.Is(wrapped, &tea.SDKError{StatusCode: Int(429)}))
+	// a sentinel without code nor status code matches nothing
+	utils.AssertEqual(t, false, errors.Is(wrapped, &SDKError{}))
+	utils.AssertEqual(t, false, errors.Is(wrapped, errors.New("Throttling")))
+}
+
+func TestSDKErrorRequestIdAndHeaders(t *testing.T) {
+	err := NewSDKError(map[string]interface{}{
+		"code": "NotFound",
+		"data": map[string]interface{}{
+			"RequestId": "req-data",
+		},
+		"headers": http.Header{
+			"X-Acs-Request-Id": []string{"req-header"},
+			"Content-Type":     []string{"application/json"},
+		},
+	})
+	utils.AssertEqual(t, "req-data", StringValue(err.GetRequestId()))
+	utils.AssertEqual(t, "application/json", StringValue(err.GetHeaders()["content-type"]))
+
+	err = NewSDKError(map[string]interface{}{
+		"code":    "NotFound",
+		"headers": map[string]string{"x-acs-request-id": "req-header"},
+	})
+	utils.AssertEqual(t, "req-header", StringValue(err.GetRequestId()))
+
+	err = NewSDKError(map[string]interface{}{
+		"requestId": "req-obj",
+		"data":      map[string]interface{}{"requestId": "req-data"},
+	})
+	utils.AssertEqual(t, "req-obj", StringValue(err.GetRequestId()))
+	utils.AssertNil(t, err.GetHeaders())
+}
+
+func TestTeaSDKErrorKeepsCause(t *testing.T) {
+	cause := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	err := NewSDKError(map[string]interface{}{
+		"code":       "ReadFailed",
+		"statusCode": 502,
+		"message":    "read failed",
+		"cause":      cause,
+	})
+	converted := TeaSDKError(err)
+	teaErr, ok := converted.(*tea.SDKError)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, "ReadFailed", StringValue(teaErr.Code))
+	var opErr *net.OpError
+	utils.AssertEqual(t, true, errors.As(converted, &opErr))
+	var sdkErr *SDKError
+	utils.AssertEqual(t, true, errors.As(converted, &sdkErr))
+	utils.AssertEqual(t, true, errors.Is(converted, &SDKError{StatusCode: Int(502)}))
+
+	// converting back returns the original error
+	utils.AssertEqual(t, err, FromTeaSDKError(converted))
+
+	// a tea.SDKError created by tea is converted field by field
+	teaErr = tea.NewSDKError(map[string]interface{}{
+		"code":       "NotFound",
+		"statusCode": 404,
+		"message":    "not found",
+		"data":       map[string]interface{}{"RequestId": "req-1"},
+		"cause":      cause,
+	})
+	back := FromTeaSDKError(teaErr).(*SDKError)
+	utils.AssertEqual(t, "NotFound", StringValue(back.Code))
+	utils.AssertEqual(t, 404, IntValue(back.StatusCode))
+	utils.AssertEqual(t, "not found", StringValue(back.Message))
+	utils.AssertEqual(t, "req-1", StringValue(back.RequestId))
+	utils.AssertEqual(t, cause, back.Unwrap())
+
+	plain := errors.New("plain")
+	utils.AssertEqual(t, plain, FromTeaSDKError(plain))
+	utils.AssertEqual(t, plain, TeaSDKError(plain))
+}
+
+func TestSDKErrorGetDataReadOnly(t *testing.T) {
+	// the embedded BaseError is still there for the code selecting it
+	sdkErr := &SDKError{BaseError: nil, Data: String(`{"RequestId":"req-1"}`)}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			utils.AssertEqual(t, "req-1", sdkErr.GetData()["RequestId"])
+		}()
+	}
+	wg.Wait()
+	utils.AssertNil(t, sdkErr.data)
+
+	sdkErr = NewSDKError(map[string]interface{}{"code": "A", "data": []string{"x"}})
+	utils.AssertNil(t, sdkErr.GetData())
+	sdkErr = FromTeaSDKError(tea.NewSDKError(map[string]interface{}{
+		"code": "A",
+		"data": map[string]interface{}{"RequestId": "req-2"},
+	})).(*SDKError)
+	utils.AssertEqual(t, "req-2", sdkErr.data["RequestId"])
+	utils.AssertEqual(t, "req-2", StringValue(sdkErr.RequestId))
+}
@@ -0,0 +1,225 @@
+package dara
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHedgingMinSamples is how many latencies are observed before a percentile threshold applies
+	DefaultHedgingMinSamples = 20
+	hedgingLatencySamples    = 100
+)
+
+// HedgingOptions configures a HedgingPolicy, every delay is in milliseconds.
+// A hedge is sent Delay after the previous copy of the request, or once Percentile,
+// between 0 and 100, of the latencies observed so far is exceeded. The percentile
+// threshold applies once MinSamples latencies were observed, until then Delay is used,
+// no hedge is sent while the delay is zero.
+type HedgingOptions struct {
+	Delay      int
+	Percentile float64
+	MinSamples int
+	// MaxHedges is the number of copies sent in addition to the request, 1 when unset
+	MaxHedges int
+}
+
+// HedgingPolicy sends extra copies of slow idempotent requests and keeps the first
+// successful response. It may be shared by several runtimes to share its latency samples.
+type HedgingPolicy struct {
+	options   HedgingOptions
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+// NewHedgingPolicy creates a HedgingPolicy
+func NewHedgingPolicy(options *HedgingOptions) *HedgingPolicy {
+	policy := &HedgingPolicy{}
+	if options != nil {
+		policy.options = *options
+	}
+	if policy.options.MinSamples <= 0 {
+		policy.options.MinSamples = DefaultHedgingMinSamples
+	}
+	if policy.options.MaxHedges <= 0 {
+		policy.options.MaxHedges = 1
+	}
+	return policy
+}
+
+// observe records the latency of a successful attempt
+func (policy *HedgingPolicy) observe(latency time.Duration) {
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	if len(policy.latencies) < hedgingLatencySamples {
+		policy.latencies = append(policy.latencies, latency)
+		return
+	}
+	policy.latencies[policy.next] = latency
+	policy.next = (policy.next + 1) % hedgingLatencySamples
+}
+
+// HedgeDelay returns how long to wait for a response before sending a hedge, zero for no hedge
+func (policy *HedgingPolicy) HedgeDelay() time.Duration {
+	delay := time.Duration(policy.options.Delay) * time.Millisecond
+	if policy.options.Percentile <= 0 {
+		return delay
+	}
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	if len(policy.latencies) < policy.options.MinSamples {
+		return delay
+	}
+	sorted := append([]time.Duration(nil), policy.latencies...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	index := int(math.Ceil(policy.options.Percentile/100*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	} else if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// isHedgeable reports whether request is an idempotent read without a body
+func isHedgeable(request *Request) bool {
+	method := strings.ToUpper(StringValue(request.Method))
+	if method != "" && method != "GET" && method != "HEAD" {
+		return false
+	}
+	return request.Body == nil || request.Body == http.NoBody
+}
+
+type hedgeResult struct {
+	index    int
+	response *Response
+	err      error
+	latency  time.Duration
+	cancel   context.CancelFunc
+}
+
+func (result *hedgeResult) succeeded() bool {
+	return result.err == nil && IntValue(result.response.StatusCode) < http.StatusInternalServerError
+}
+
+// discard releases the connection and the context of a result that is not returned
+func (result *hedgeResult) discard() {
+	if result.response != nil && result.response.Body != nil {
+		result.response.Body.Close()
+	}
+	result.cancel()
+}
+
+// doHedgedRequest sends request and, while no response arrived, up to MaxHedges copies of it.
+// The first successful response is returned and the other copies are cancelled, when every
+// copy failed the last response received, or else the last error, is returned. Every hedge
+// is withdrawn from the retry budget of the runtime.
+func doHedgedRequest(ctx context.Context, request *Request, runtimeObject *RuntimeObject) (*Response, error) {
+	policy := runtimeObject.Hedging
+	// the request is normalized once, as doRequest does, so the caller sees the same request
+	// whether it was hedged or not, the copies only differ by their headers map
+	normalizeRequest(request)
+	if request.Headers == nil {
+		request.Headers = map[string]*string{}
+	}
+	if err := setProxyAuthorization(request, runtimeObject); err != nil {
+		return nil, err
+	}
+	results := make(chan *hedgeResult, policy.options.MaxHedges+1)
+	var cancels []context.CancelFunc
+	send := func() {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		// every copy gets its own headers, which doRequest writes
+		attempt := *request
+		attempt.Headers = make(map[string]*string, len(request.Headers))
+		for key, value := range request.Headers {
+			attempt.Headers[key] = value
+		}
+		go func() {
+			start := time.Now()
+			response, err := doRequest(attemptCtx, &attempt, runtimeObject)
+			results <- &hedgeResult{index: index, response: response, err: err, latency: time.Since(start), cancel: cancel}
+		}()
+	}
+
+	send()
+	pending, hedges := 1, 0
+	var timer <-chan time.Time
+	schedule := func() {
+		timer = nil
+		if hedges >= policy.options.MaxHedges {
+			return
+		}
+		if delay := policy.HedgeDelay(); delay > 0 {
+			timer = time.After(delay)
+		}
+	}
+	schedule()
+
+	var failed *hedgeResult
+	for pending > 0 {
+		select {
+		case <-timer:
+			var budget *RetryBudget
+			if runtimeObject.RetryOptions != nil {
+				budget = runtimeObject.RetryOptions.Budget
+			}
+			if !budget.Withdraw() {
+				timer = nil
+				continue
+			}
+			hedges++
+			pending++
+			send()
+			schedule()
+		case result := <-results:
+			pending--
+			if result.succeeded() {
+				policy.observe(result.latency)
+				for index, cancel := range cancels {
+					if index != result.index {
+						cancel()
+					}
+				}
+				go drainHedges(results, pending)
+				if failed != nil {
+					failed.discard()
+				}
+				result.response.Body = &cancelOnCloseBody{ReadCloser: result.response.Body, cancel: result.cancel}
+				return result.response, nil
+			}
+			// prefer a response over an error to tell the caller what the server said
+			if failed == nil || failed.response == nil || result.response != nil {
+				if failed != nil {
+					failed.discard()
+				}
+				failed = result
+			} else {
+				result.discard()
+			}
+		}
+	}
+	if failed.response != nil {
+		failed.response.Body = &cancelOnCloseBody{ReadCloser: failed.response.Body, cancel: failed.cancel}
+	} else {
+		failed.cancel()
+	}
+	return failed.response, failed.err
+}
+
+// drainHedges discards the results of the cancelled copies
+func drainHedges(results chan *hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		(<-results).discard()
+	}
+}
@@ -0,0 +1,131 @@
+package dara
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_HedgingPolicyDelay(t *testing.T) {
+	policy := NewHedgingPolicy(&HedgingOptions{Delay: 50, Percentile: 90, MinSamples: 10})
+	utils.AssertEqual(t, 50*time.Millisecond, policy.HedgeDelay())
+	for i := 1; i <= 10; i++ {
+		policy.observe(time.Duration(i) * time.Millisecond)
+	}
+	utils.AssertEqual(t, 9*time.Millisecond, policy.HedgeDelay())
+
+	// only the latest samples are kept
+	for i := 0; i < hedgingLatencySamples; i++ {
+		policy.observe(time.Second)
+	}
+	utils.AssertEqual(t, time.Second, policy.HedgeDelay())
+
+	utils.AssertEqual(t, time.Duration(0), NewHedgingPolicy(nil).HedgeDelay())
+}
+
+func Test_isHedgeable(t *testing.T) {
+	request := NewRequest()
+	utils.AssertEqual(t, true, isHedgeable(request))
+	request.Method = String("head")
+	utils.AssertEqual(t, true, isHedgeable(request))
+	request.Body = strings.NewReader("body")
+	utils.AssertEqual(t, false, isHedgeable(request))
+	request.Body = nil
+	request.Method = String("POST")
+	utils.AssertEqual(t, false, isHedgeable(request))
+}
+
+func Test_DoRequestWithHedging(t *testing.T) {
+	var calls, cancelled int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&cancelled, 1)
+				return
+			case <-time.After(5 * time.Second):
+			}
+			w.Write([]byte("slow"))
+			return
+		}
+		w.Write([]byte("fast"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"noProxy": host,
+		"hedging": NewHedgingPolicy(&HedgingOptions{Delay: 20}),
+	})
+	request := NewRequest()
+	request.Headers["host"] = String(host)
+	start := time.Now()
+	resp, err := DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	body, err := resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "fast", string(body))
+	utils.AssertEqual(t, true, time.Since(start) < 3*time.Second)
+	utils.AssertEqual(t, int32(2), atomic.LoadInt32(&calls))
+
+	// the slow copy is cancelled
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(&cancelled) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	utils.AssertEqual(t, int32(1), atomic.LoadInt32(&cancelled))
+	// the request of the caller is normalized as without hedging
+	utils.AssertEqual(t, host, StringValue(request.Domain))
+	utils.AssertEqual(t, "GET", StringValue(request.Method))
+	utils.AssertEqual(t, "http", StringValue(request.Protocol))
+
+	// hedges are withdrawn from the retry budget
+	atomic.StoreInt32(&calls, 0)
+	budget := NewRetryBudget(&RetryBudgetOptions{MinRetries: 1, Clock: newFakeClock()})
+	budget.Withdraw()
+	runtime.RetryOptions = &RetryOptions{Budget: budget}
+	runtime.ReadTimeout = Int(200)
+	_, err = DoRequest(request, runtime)
+	utils.AssertContains(t, err.Error(), "context deadline exceeded")
+	utils.AssertEqual(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func Test_DoRequestWithHedgingFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(503)
+		w.Write([]byte("unavailable"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	runtime := &RuntimeObject{
+		NoProxy: String(host),
+		Hedging: NewHedgingPolicy(&HedgingOptions{Delay: 10, MaxHedges: 2}),
+	}
+	request := NewRequest()
+	request.Headers["host"] = String(host)
+	resp, err := DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 503, IntValue(resp.StatusCode))
+	body, err := resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "unavailable", string(body))
+	utils.AssertEqual(t, int32(3), atomic.LoadInt32(&calls))
+
+	// requests with a body are never hedged
+	atomic.StoreInt32(&calls, 0)
+	request.Method = String("POST")
+	request.Body = strings.NewReader("body")
+	_, err = DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,48 @@
+package dara
+
+import (
+	"errors"
+	"net/http"
+)
+
+// RoundTripFunc sends a prepared http request and returns its response
+type RoundTripFunc func(request *http.Request) (*http.Response, error)
+
+// Interceptor wraps the sending of a request. An interceptor may inspect or
+// mutate the request before calling next, inspect or replace the response and
+// error returned by next, or return without calling next to short-circuit it.
+type Interceptor interface {
+	Intercept(request *http.Request, next RoundTripFunc) (*http.Response, error)
+}
+
+// InterceptorFunc adapts an ordinary function to the Interceptor interface
+type InterceptorFunc func(request *http.Request, next RoundTripFunc) (*http.Response, error)
+
+// Intercept calls fn(request, next)
+func (fn InterceptorFunc) Intercept(request *http.Request, next RoundTripFunc) (*http.Response, error) {
+	return fn(request, next)
+}
+
+var errEmptyInterceptorResult = errors.New("interceptor returned neither a response nor an error")
+
+// chainInterceptors builds a RoundTripFunc running interceptors in order around final,
+// the first interceptor being the outermost one
+func chainInterceptors(interceptors []Interceptor, final RoundTripFunc) RoundTripFunc {
+	next := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		if interceptors[i] == nil {
+			continue
+		}
+		interceptor, inner := interceptors[i], next
+		next = func(request *http.Request) (*http.Response, error) {
+			return interceptor.Intercept(request, inner)
+		}
+	}
+	return func(request *http.Request) (*http.Response, error) {
+		res, err := next(request)
+		if res == nil && err == nil {
+			err = errEmptyInterceptorResult
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,96 @@
+package dara
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_chainInterceptors(t *testing.T) {
+	var order []string
+	record := func(name string) Interceptor {
+		return InterceptorFunc(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+			order = append(order, "before "+name)
+			res, err := next(req)
+			order = append(order, "after "+name)
+			return res, err
+		})
+	}
+	final := func(req *http.Request) (*http.Response, error) {
+		order = append(order, "send")
+		return mockResponse(200, ``, nil)
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	res, err := chainInterceptors([]Interceptor{record("a"), nil, record("b")}, final)(req)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, res.StatusCode)
+	utils.AssertEqual(t, []string{"before a", "before b", "send", "after b", "after a"}, order)
+
+	empty := InterceptorFunc(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		return nil, nil
+	})
+	res, err = chainInterceptors([]Interceptor{empty}, final)(req)
+	utils.AssertNil(t, res)
+	utils.AssertEqual(t, errEmptyInterceptorResult, err)
+}
+
+func Test_DoRequestWithInterceptors(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			utils.AssertEqual(t, "signed", req.Header.Get("Authorization"))
+			return mockResponse(200, ``, nil)
+		}
+	}
+
+	sign := InterceptorFunc(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		req.Header.Set("Authorization", "signed")
+		res, err := next(req)
+		if err == nil {
+			res.Header.Set("X-Intercepted", "true")
+		}
+		return res, err
+	})
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"interceptors": []Interceptor{sign},
+	})
+	resp, err := DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "true", StringValue(resp.Headers["x-intercepted"]))
+
+	resp, err = DoRequestWithCtx(context.Background(), NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "true", StringValue(resp.Headers["x-intercepted"]))
+
+	// an interceptor may short-circuit the request
+	reject := InterceptorFunc(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		return nil, errors.New("rejected by interceptor")
+	})
+	runtime.Interceptors = append([]Interceptor{reject}, runtime.Interceptors...)
+	resp, err = DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, resp)
+	utils.AssertEqual(t, "rejected by interceptor", err.Error())
+}
+
+func Test_RuntimeObjectWithInterceptorsMarshal(t *testing.T) {
+	runtime := &RuntimeObject{
+		ReadTimeout: Int(100),
+		Interceptors: []Interceptor{InterceptorFunc(func(request *http.Request, next RoundTripFunc) (*http.Response, error) {
+			return next(request)
+		})},
+		StructuredLogger: utils.NewJSONLogger(nil),
+		CircuitBreaker:   NewCircuitBreaker(nil),
+		Hedging:          &HedgingPolicy{},
+	}
+	byt, err := json.Marshal(runtime)
+	utils.AssertNil(t, err)
+	utils.AssertContains(t, string(byt), `"readTimeout":100`)
+	utils.AssertEqual(t, false, strings.Contains(string(byt), "interceptors"))
+}
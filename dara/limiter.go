@@ -0,0 +1,211 @@
+package dara
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket allowing Rate requests per second with bursts of up to Burst requests
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a full RateLimiter, a rate of zero or less does not limit anything
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (limiter *RateLimiter) reserve() time.Duration {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	now := time.Now()
+	if !limiter.last.IsZero() {
+		limiter.tokens = math.Min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.rate)
+	}
+	limiter.last = now
+	limiter.tokens--
+	if limiter.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+}
+
+// Wait blocks until a request may be sent or ctx is done and returns how long it waited
+func (limiter *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	if limiter == nil || limiter.rate <= 0 {
+		return 0, nil
+	}
+	delay := limiter.reserve()
+	if delay <= 0 {
+		return 0, nil
+	}
+	start := time.Now()
+	if err := sleepWithContext(ctx, delay); err != nil {
+		// give the unused token back
+		limiter.mu.Lock()
+		limiter.tokens = math.Min(limiter.burst, limiter.tokens+1)
+		limiter.mu.Unlock()
+		return time.Since(start), err
+	}
+	return time.Since(start), nil
+}
+
+// ConcurrencyLimiter caps the number of requests in flight
+type ConcurrencyLimiter struct {
+	slots chan struct{}
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter letting max requests in flight
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	if max < 1 {
+		max = 1
+	}
+	return &ConcurrencyLimiter{
+		slots: make(chan struct{}, max),
+	}
+}
+
+// Acquire blocks until a slot is free or ctx is done and returns how long it waited,
+// every acquired slot must be given back with Release
+func (limiter *ConcurrencyLimiter) Acquire(ctx context.Context) (time.Duration, error) {
+	select {
+	case limiter.slots <- struct{}{}:
+		return 0, nil
+	default:
+	}
+	start := time.Now()
+	select {
+	case limiter.slots <- struct{}{}:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// Release gives back a slot taken by Acquire
+func (limiter *ConcurrencyLimiter) Release() {
+	<-limiter.slots
+}
+
+// InFlight returns the number of slots in use
+func (limiter *ConcurrencyLimiter) InFlight() int {
+	return len(limiter.slots)
+}
+
+// HostLimits are the limits applied to a single host, zero values do not limit anything
+type HostLimits struct {
+	// Rate is the number of requests per second and Burst how many may be sent at once
+	Rate        float64
+	Burst       int
+	MaxInFlight int
+}
+
+// HostLimiter gives every host its own rate and concurrency limiters
+type HostLimiter struct {
+	mu          sync.Mutex
+	defaults    HostLimits
+	overrides   map[string]HostLimits
+	rate        map[string]*RateLimiter
+	concurrency map[string]*ConcurrencyLimiter
+}
+
+// NewHostLimiter creates a HostLimiter applying defaults to every host without limits of its own
+func NewHostLimiter(defaults *HostLimits) *HostLimiter {
+	limiter := &HostLimiter{
+		overrides:   make(map[string]HostLimits),
+		rate:        make(map[string]*RateLimiter),
+		concurrency: make(map[string]*ConcurrencyLimiter),
+	}
+	if defaults != nil {
+		limiter.defaults = *defaults
+	}
+	return limiter
+}
+
+// SetLimits sets the limits of host, replacing its current limiters
+func (limiter *HostLimiter) SetLimits(host string, limits *HostLimits) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if limits == nil {
+		delete(limiter.overrides, host)
+	} else {
+		limiter.overrides[host] = *limits
+	}
+	delete(limiter.rate, host)
+	delete(limiter.concurrency, host)
+}
+
+// limiters returns the limiters of host, nil for the limits that are not set
+func (limiter *HostLimiter) limiters(host string) (*RateLimiter, *ConcurrencyLimiter) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limits, ok := limiter.overrides[host]
+	if !ok {
+		limits = limiter.defaults
+	}
+	rate, ok := limiter.rate[host]
+	if !ok && limits.Rate > 0 {
+		rate = NewRateLimiter(limits.Rate, limits.Burst)
+		limiter.rate[host] = rate
+	}
+	concurrency, ok := limiter.concurrency[host]
+	if !ok && limits.MaxInFlight > 0 {
+		concurrency = NewConcurrencyLimiter(limits.MaxInFlight)
+		limiter.concurrency[host] = concurrency
+	}
+	return rate, concurrency
+}
+
+// acquireLimits waits for the rate and then for the concurrency limits of the runtime and of host,
+// it returns the total wait and the func releasing the acquired slots
+func acquireLimits(ctx context.Context, host string, runtimeObject *RuntimeObject) (time.Duration, func(), error) {
+	rateLimiters := []*RateLimiter{runtimeObject.RateLimiter}
+	concurrencyLimiters := []*ConcurrencyLimiter{runtimeObject.ConcurrencyLimiter}
+	if runtimeObject.HostLimiter != nil {
+		rate, concurrency := runtimeObject.HostLimiter.limiters(host)
+		rateLimiters = append(rateLimiters, rate)
+		concurrencyLimiters = append(concurrencyLimiters, concurrency)
+	}
+
+	var total time.Duration
+	var acquired []*ConcurrencyLimiter
+	release := func() {
+		for _, limiter := range acquired {
+			limiter.Release()
+		}
+	}
+	for _, limiter := range rateLimiters {
+		wait, err := limiter.Wait(ctx)
+		total += wait
+		if err != nil {
+			return total, release, err
+		}
+	}
+	for _, limiter := range concurrencyLimiters {
+		if limiter == nil {
+			continue
+		}
+		wait, err := limiter.Acquire(ctx)
+		total += wait
+		if err != nil {
+			release()
+			return total, func() {}, err
+		}
+		acquired = append(acquired, limiter)
+	}
+	return total, release, nil
+}
@@ -0,0 +1,159 @@
+package dara
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_RateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(50, 2)
+	ctx := context.Background()
+	// the burst goes through at once
+	for i := 0; i < 2; i++ {
+		wait, err := limiter.Wait(ctx)
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, time.Duration(0), wait)
+	}
+	wait, err := limiter.Wait(ctx)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, wait >= 10*time.Millisecond)
+
+	// a cancelled wait gives its token back
+	limiter = NewRateLimiter(1, 1)
+	limiter.Wait(ctx)
+	cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.Wait(cancelled)
+	utils.AssertEqual(t, context.DeadlineExceeded, err)
+	utils.AssertEqual(t, true, limiter.tokens > -1)
+
+	var unlimited *RateLimiter
+	wait, err = unlimited.Wait(ctx)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, time.Duration(0), wait)
+	wait, err = NewRateLimiter(0, 0).Wait(ctx)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, time.Duration(0), wait)
+}
+
+func Test_ConcurrencyLimiter(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1)
+	ctx := context.Background()
+	wait, err := limiter.Acquire(ctx)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, time.Duration(0), wait)
+	utils.AssertEqual(t, 1, limiter.InFlight())
+
+	cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.Acquire(cancelled)
+	utils.AssertEqual(t, context.DeadlineExceeded, err)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		limiter.Release()
+	}()
+	wait, err = limiter.Acquire(ctx)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, wait >= 10*time.Millisecond)
+	limiter.Release()
+	utils.AssertEqual(t, 0, limiter.InFlight())
+}
+
+func Test_HostLimiter(t *testing.T) {
+	limiter := NewHostLimiter(&HostLimits{MaxInFlight: 2})
+	rate, concurrency := limiter.limiters("ecs.aliyuncs.com")
+	utils.AssertNil(t, rate)
+	utils.AssertEqual(t, 2, cap(concurrency.slots))
+	_, same := limiter.limiters("ecs.aliyuncs.com")
+	utils.AssertEqual(t, true, concurrency == same)
+
+	limiter.SetLimits("vpc.aliyuncs.com", &HostLimits{Rate: 10, Burst: 5})
+	rate, concurrency = limiter.limiters("vpc.aliyuncs.com")
+	utils.AssertNil(t, concurrency)
+	utils.AssertEqual(t, float64(5), rate.burst)
+
+	limiter.SetLimits("vpc.aliyuncs.com", nil)
+	rate, concurrency = limiter.limiters("vpc.aliyuncs.com")
+	utils.AssertNil(t, rate)
+	utils.AssertEqual(t, 2, cap(concurrency.slots))
+}
+
+func Test_DoRequestWithConcurrencyLimit(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return mockResponse(200, ``, nil)
+		}
+	}
+
+	records := &recordingLogger{}
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"concurrencyLimiter": NewConcurrencyLimiter(2),
+		"hostLimiter":        NewHostLimiter(&HostLimits{MaxInFlight: 3}),
+		"structuredLogger":   records,
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := DoRequest(NewRequest(), runtime)
+			utils.AssertNil(t, err)
+		}()
+	}
+	wg.Wait()
+	utils.AssertEqual(t, 2, maxInFlight)
+	utils.AssertEqual(t, 0, runtime.ConcurrencyLimiter.InFlight())
+
+	waited := false
+	for _, record := range records.list() {
+		if record.Wait > 0 {
+			waited = true
+		}
+	}
+	utils.AssertEqual(t, true, waited)
+
+	// a request giving up while held by a limiter is not sent
+	runtime.RateLimiter = NewRateLimiter(1, 1)
+	runtime.RateLimiter.Wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := DoRequestWithCtx(ctx, NewRequest(), runtime)
+	utils.AssertContains(t, err.Error(), "context deadline exceeded")
+	utils.AssertEqual(t, "CanceledError", StringValue(err.(BaseError).GetName()))
+	utils.AssertEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+
+	// so is a request cancelled while waiting for a concurrency slot
+	runtime.RateLimiter = nil
+	runtime.ConcurrencyLimiter = NewConcurrencyLimiter(1)
+	runtime.ConcurrencyLimiter.Acquire(context.Background())
+	defer runtime.ConcurrencyLimiter.Release()
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = DoRequestWithCtx(ctx, NewRequest(), runtime)
+	utils.AssertEqual(t, "CanceledError", StringValue(err.(BaseError).GetName()))
+	utils.AssertEqual(t, true, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,65 @@
+package dara
+
+import (
+	"sort"
+	"strings"
+)
+
+// QueryParam is a single key and value of a query string, a nil Value is left out
+type QueryParam struct {
+	Key   string
+	Value *string
+}
+
+// QueryEncoder turns query params into the raw query string of a request url
+type QueryEncoder func(params []*QueryParam) string
+
+// DefaultQueryEncoder sorts params by key, keeping the order of repeated keys,
+// and encodes them with PercentEncode as the signers do
+func DefaultQueryEncoder(params []*QueryParam) string {
+	sorted := make([]*QueryParam, 0, len(params))
+	for _, param := range params {
+		if param != nil {
+			sorted = append(sorted, param)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+	return OrderedQueryEncoder(sorted)
+}
+
+// OrderedQueryEncoder encodes params with PercentEncode in the given order
+func OrderedQueryEncoder(params []*QueryParam) string {
+	pairs := make([]string, 0, len(params))
+	for _, param := range params {
+		if param == nil || param.Value == nil {
+			continue
+		}
+		pairs = append(pairs, PercentEncode(param.Key)+"="+PercentEncode(StringValue(param.Value)))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// queryParams lists the Query map sorted by key followed by the QueryParams of the request
+func (request *Request) queryParams() []*QueryParam {
+	keys := make([]string, 0, len(request.Query))
+	for key := range request.Query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]*QueryParam, 0, len(keys)+len(request.QueryParams))
+	for _, key := range keys {
+		params = append(params, &QueryParam{Key: key, Value: request.Query[key]})
+	}
+	return append(params, request.QueryParams...)
+}
+
+// encodeQuery encodes the query of the request with its QueryEncoder
+func (request *Request) encodeQuery() string {
+	encoder := request.QueryEncoder
+	if encoder == nil {
+		encoder = DefaultQueryEncoder
+	}
+	return encoder(request.queryParams())
+}
@@ -0,0 +1,41 @@
+package dara
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_DefaultQueryEncoder(t *testing.T) {
+	params := []*QueryParam{
+		{Key: "b", Value: String("2")},
+		{Key: "a", Value: String("x y*~")},
+		{Key: "b", Value: String("1")},
+		{Key: "nil", Value: nil},
+		{Key: "empty", Value: String("")},
+		nil,
+	}
+	utils.AssertEqual(t, "a=x%20y%2A~&b=2&b=1&empty=", DefaultQueryEncoder(params))
+	utils.AssertEqual(t, "b=2&a=x%20y%2A~&b=1&empty=", OrderedQueryEncoder(params))
+	utils.AssertEqual(t, "", DefaultQueryEncoder(nil))
+}
+
+func Test_encodeQuery(t *testing.T) {
+	request := NewRequest()
+	request.Query["z"] = String("last")
+	request.Query["a"] = String("first")
+	request.Query["nil"] = nil
+	request.QueryParams = []*QueryParam{
+		{Key: "tag", Value: String("b")},
+		{Key: "tag", Value: String("a")},
+	}
+	utils.AssertEqual(t, "a=first&tag=b&tag=a&z=last", request.encodeQuery())
+
+	request.QueryEncoder = OrderedQueryEncoder
+	utils.AssertEqual(t, "a=first&z=last&tag=b&tag=a", request.encodeQuery())
+
+	request.QueryEncoder = func(params []*QueryParam) string {
+		return "custom"
+	}
+	utils.AssertEqual(t, "custom", request.encodeQuery())
+}
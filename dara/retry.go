@@ -1,9 +1,17 @@
 package dara
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"math/rand"
+	"net/http"
+	"strings"
+	"time"
 )
 
 const (
@@ -20,6 +28,8 @@ type RetryPolicyContext struct {
 	HttpRequest      *Request  // placeholder for actual http.Request type
 	HttpResponse     *Response // placeholder for actual http.Response type
 	Exception        error
+	// PreviousDelay is the delay in milliseconds waited before the last attempt
+	PreviousDelay int
 }
 
 // BackoffPolicy interface with a method to get delay time
@@ -27,10 +37,143 @@ type BackoffPolicy interface {
 	GetDelayTime(ctx *RetryPolicyContext) int
 }
 
-// BackoffPolicyFactory creates a BackoffPolicy based on the option
+// RandSource draws the random delays of the jitter policies, *rand.Rand implements it.
+// A policy without one uses the global source of math/rand.
+type RandSource interface {
+	Int63n(n int64) int64
+}
+
+// randInt63n returns a random number in [0, n), zero when n is not positive
+func randInt63n(source RandSource, n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	if source == nil {
+		return rand.Int63n(n)
+	}
+	return source.Int63n(n)
+}
+
+// backoffOptions holds the options shared by the backoff policies
+type backoffOptions struct {
+	period   int
+	cap      int
+	rand     RandSource
+	clock    Clock
+	fallback BackoffPolicy
+}
+
+// parseBackoffOptions reads the "period", "cap", "rand", "clock" and "fallback" options,
+// every option of the wrong type is reported and left to its default, the others are kept
+func parseBackoffOptions(option map[string]interface{}, defaultCap int) (*backoffOptions, error) {
+	opts := &backoffOptions{cap: defaultCap}
+	var errs []string
+	if v, ok := option["period"]; ok {
+		period, err := toInt(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid backoff option period: %s", err))
+		} else {
+			opts.period = period
+		}
+	}
+	if v, ok := option["cap"]; ok {
+		capDelay, err := toInt(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid backoff option cap: %s", err))
+		} else {
+			opts.cap = capDelay
+		}
+	}
+	if v, ok := option["rand"]; ok && v != nil {
+		if source, ok := v.(RandSource); ok {
+			opts.rand = source
+		} else {
+			errs = append(errs, fmt.Sprintf("invalid backoff option rand: %T is not a RandSource", v))
+		}
+	}
+	if v, ok := option["clock"]; ok && v != nil {
+		if clock, ok := v.(Clock); ok {
+			opts.clock = clock
+		} else {
+			errs = append(errs, fmt.Sprintf("invalid backoff option clock: %T is not a Clock", v))
+		}
+	}
+	if v, ok := option["fallback"]; ok && v != nil {
+		switch fallback := v.(type) {
+		case BackoffPolicy:
+			opts.fallback = fallback
+		case map[string]interface{}:
+			policy, err := BackoffPolicyFactory(fallback)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("invalid backoff option fallback: %s", err))
+			} else {
+				opts.fallback = policy
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("invalid backoff option fallback: %T is neither a BackoffPolicy nor an option map", v))
+		}
+	}
+	if len(errs) > 0 {
+		return opts, errors.New(strings.Join(errs, "; "))
+	}
+	return opts, nil
+}
+
+// toInt converts the numbers decoded from code, JSON or YAML to an int
+func toInt(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int32:
+		return int(n), nil
+	case int64:
+		return int(n), nil
+	case uint:
+		return int(n), nil
+	case uint32:
+		return int(n), nil
+	case uint64:
+		return int(n), nil
+	case float32:
+		if float32(int(n)) == n {
+			return int(n), nil
+		}
+	case float64:
+		if float64(int(n)) == n {
+			return int(n), nil
+		}
+	case json.Number:
+		i, err := n.Int64()
+		if err == nil {
+			return int(i), nil
+		}
+	case *int:
+		if n != nil {
+			return *n, nil
+		}
+	}
+	return 0, fmt.Errorf("%v (%T) is not an integer", v, v)
+}
+
+// BackoffPolicyFactory creates a BackoffPolicy based on the option, options of the wrong type are reported
 func BackoffPolicyFactory(option map[string]interface{}) (BackoffPolicy, error) {
+	policy, ok := option["policy"].(string)
+	if !ok {
+		return nil, fmt.Errorf("backoff policy must be a string, got %T", option["policy"])
+	}
+	var err error
+	switch policy {
+	case "Fixed", "Random", "Exponential", "EqualJitter", "ExponentialWithEqualJitter",
+		"FullJitter", "ExponentialWithFullJitter", "DecorrelatedJitter", "ServerDirected":
+		_, err = parseBackoffOptions(option, 0)
+	default:
+		return nil, fmt.Errorf("unknown policy type")
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	switch option["policy"] {
+	switch policy {
 	case "Fixed":
 		return NewFixedBackoffPolicy(option), nil
 	case "Random":
@@ -41,8 +184,11 @@ func BackoffPolicyFactory(option map[string]interface{}) (BackoffPolicy, error)
 		return NewEqualJitterBackoffPolicy(option), nil
 	case "FullJitter", "ExponentialWithFullJitter":
 		return NewFullJitterBackoffPolicy(option), nil
+	case "DecorrelatedJitter":
+		return NewDecorrelatedJitterBackoffPolicy(option), nil
+	default:
+		return NewServerDirectedBackoffPolicy(option), nil
 	}
-	return nil, fmt.Errorf("unknown policy type")
 }
 
 // FixedBackoffPolicy implementation
@@ -51,12 +197,9 @@ type FixedBackoffPolicy struct {
 }
 
 func NewFixedBackoffPolicy(option map[string]interface{}) *FixedBackoffPolicy {
-	var period int
-	if v, ok := option["period"]; ok {
-		period = v.(int)
-	}
+	opts, _ := parseBackoffOptions(option, 0)
 	return &FixedBackoffPolicy{
-		Period: period,
+		Period: opts.period,
 	}
 }
 
@@ -68,28 +211,21 @@ func (f *FixedBackoffPolicy) GetDelayTime(ctx *RetryPolicyContext) int {
 type RandomBackoffPolicy struct {
 	Period int
 	Cap    int
+	Rand   RandSource
 }
 
 func NewRandomBackoffPolicy(option map[string]interface{}) *RandomBackoffPolicy {
-	var capValue int
-	var period int
-	if v, ok := option["cap"]; ok {
-		capValue = v.(int)
-	} else {
-		capValue = 20 * 1000
-	}
-	if v, ok := option["period"]; ok {
-		period = v.(int)
-	}
+	opts, _ := parseBackoffOptions(option, 20*1000)
 	return &RandomBackoffPolicy{
-		Period: period,
-		Cap:    capValue,
+		Period: opts.period,
+		Cap:    opts.cap,
+		Rand:   opts.rand,
 	}
 }
 
 func (r *RandomBackoffPolicy) GetDelayTime(ctx *RetryPolicyContext) int {
 	randomSeed := int64(ctx.RetriesAttempted * r.Period)
-	randomTime := int(rand.Int63n(randomSeed))
+	randomTime := int(randInt63n(r.Rand, randomSeed))
 	if randomTime > r.Cap {
 		return r.Cap
 	}
@@ -103,19 +239,10 @@ type ExponentialBackoffPolicy struct {
 }
 
 func NewExponentialBackoffPolicy(option map[string]interface{}) *ExponentialBackoffPolicy {
-	var capValue int
-	var period int
-	if v, ok := option["cap"]; ok {
-		capValue = v.(int)
-	} else {
-		capValue = DEFAULT_MAX_CAP
-	}
-	if v, ok := option["period"]; ok {
-		period = v.(int)
-	}
+	opts, _ := parseBackoffOptions(option, DEFAULT_MAX_CAP)
 	return &ExponentialBackoffPolicy{
-		Period: period,
-		Cap:    capValue,
+		Period: opts.period,
+		Cap:    opts.cap,
 	}
 }
 
@@ -131,29 +258,21 @@ func (e *ExponentialBackoffPolicy) GetDelayTime(ctx *RetryPolicyContext) int {
 type EqualJitterBackoffPolicy struct {
 	Period int
 	Cap    int
+	Rand   RandSource
 }
 
 func NewEqualJitterBackoffPolicy(option map[string]interface{}) *EqualJitterBackoffPolicy {
-	var capValue int
-	var period int
-	if v, ok := option["cap"]; ok {
-		capValue = v.(int)
-	} else {
-		capValue = DEFAULT_MAX_CAP
-	}
-
-	if v, ok := option["period"]; ok {
-		period = v.(int)
-	}
+	opts, _ := parseBackoffOptions(option, DEFAULT_MAX_CAP)
 	return &EqualJitterBackoffPolicy{
-		Period: period,
-		Cap:    capValue,
+		Period: opts.period,
+		Cap:    opts.cap,
+		Rand:   opts.rand,
 	}
 }
 
 func (e *EqualJitterBackoffPolicy) GetDelayTime(ctx *RetryPolicyContext) int {
 	ceil := int64(math.Min(float64(e.Cap), float64(math.Pow(2, float64(ctx.RetriesAttempted)*float64(e.Period)))))
-	randNum := rand.Int63n(ceil/2 + 1)
+	randNum := randInt63n(e.Rand, ceil/2+1)
 	return int(ceil/2 + randNum)
 }
 
@@ -161,102 +280,155 @@ func (e *EqualJitterBackoffPolicy) GetDelayTime(ctx *RetryPolicyContext) int {
 type FullJitterBackoffPolicy struct {
 	Period int
 	Cap    int
+	Rand   RandSource
 }
 
 func NewFullJitterBackoffPolicy(option map[string]interface{}) *FullJitterBackoffPolicy {
-	var capValue int
-	var period int
-	if v, ok := option["cap"]; ok {
-		capValue = v.(int)
-	} else {
-		capValue = DEFAULT_MAX_CAP
-	}
-	if v, ok := option["period"]; ok {
-		period = v.(int)
-	}
+	opts, _ := parseBackoffOptions(option, DEFAULT_MAX_CAP)
 	return &FullJitterBackoffPolicy{
-		Period: period,
-		Cap:    capValue,
+		Period: opts.period,
+		Cap:    opts.cap,
+		Rand:   opts.rand,
 	}
 }
 
 func (f *FullJitterBackoffPolicy) GetDelayTime(ctx *RetryPolicyContext) int {
 	ceil := int64(math.Min(float64(f.Cap), float64(math.Pow(2, float64(ctx.RetriesAttempted)*float64(f.Period)))))
-	return int(rand.Int63n(ceil))
+	return int(randInt63n(f.Rand, ceil))
 }
 
-// RetryCondition holds the retry conditions
-type RetryCondition struct {
-	MaxAttempts int
-	Backoff     BackoffPolicy
-	Exception   []string
-	ErrorCode   []string
-	MaxDelay    int
+// DecorrelatedJitterBackoffPolicy waits a random delay between Period and three times
+// the previous delay, capped by Cap
+type DecorrelatedJitterBackoffPolicy struct {
+	Period int
+	Cap    int
+	Rand   RandSource
 }
 
-func NewRetryCondition(condition map[string]interface{}) *RetryCondition {
-	var backoff BackoffPolicy
-	if condition["backoff"] != nil {
-		backoffOption := condition["backoff"].(map[string]interface{})
-		backoff, _ = BackoffPolicyFactory(backoffOption)
+func NewDecorrelatedJitterBackoffPolicy(option map[string]interface{}) *DecorrelatedJitterBackoffPolicy {
+	opts, _ := parseBackoffOptions(option, DEFAULT_MAX_CAP)
+	return &DecorrelatedJitterBackoffPolicy{
+		Period: opts.period,
+		Cap:    opts.cap,
+		Rand:   opts.rand,
 	}
-	maxAttempts, ok := condition["maxAttempts"].(int)
-	if !ok {
-		maxAttempts = MAX_ATTEMPTS
+}
+
+func (d *DecorrelatedJitterBackoffPolicy) GetDelayTime(ctx *RetryPolicyContext) int {
+	previous := ctx.PreviousDelay
+	if previous < d.Period {
+		previous = d.Period
+	}
+	upper := int64(previous) * 3
+	delay := int64(d.Period) + randInt63n(d.Rand, upper-int64(d.Period)+1)
+	if delay > int64(d.Cap) {
+		return d.Cap
 	}
+	return int(delay)
+}
 
-	exception, ok := condition["exception"].([]string)
-	if !ok {
-		exception = []string{}
+// ServerDirectedBackoffPolicy waits as long as the server asked to, with the Retry-After
+// or x-ratelimit-reset headers of the response or the retry after of the error. Without
+// such a hint it waits as the Fallback policy does, or else Period. The delay is capped by Cap.
+type ServerDirectedBackoffPolicy struct {
+	Period   int
+	Cap      int
+	Fallback BackoffPolicy
+	Clock    Clock
+}
+
+func NewServerDirectedBackoffPolicy(option map[string]interface{}) *ServerDirectedBackoffPolicy {
+	opts, _ := parseBackoffOptions(option, MAX_DELAY_TIME)
+	return &ServerDirectedBackoffPolicy{
+		Period:   opts.period,
+		Cap:      opts.cap,
+		Fallback: opts.fallback,
+		Clock:    opts.clock,
 	}
+}
 
-	errorCode, ok := condition["errorCode"].([]string)
-	if !ok {
-		errorCode = []string{}
+// serverDelay returns the delay in milliseconds the server asked for
+func (s *ServerDirectedBackoffPolicy) serverDelay(ctx *RetryPolicyContext) (int64, bool) {
+	if ctx.HttpResponse != nil {
+		clock := s.Clock
+		if clock == nil {
+			clock = SystemClock
+		}
+		now := clock.Now()
+		headers := normalizeHeaders(ctx.HttpResponse.Headers)
+		if delay := retryAfterFromHeaders(headers, ParseRateLimit(headers, now), now); delay != nil {
+			return *delay, true
+		}
 	}
+	if respErr, ok := ctx.Exception.(ResponseError); ok {
+		if retryAfter := respErr.GetRetryAfter(); retryAfter != nil {
+			return *retryAfter, true
+		}
+	}
+	return 0, false
+}
 
-	maxDelay, ok := condition["maxDelay"].(int)
+func (s *ServerDirectedBackoffPolicy) GetDelayTime(ctx *RetryPolicyContext) int {
+	delay, ok := s.serverDelay(ctx)
 	if !ok {
-		maxDelay = MAX_DELAY_TIME
+		if s.Fallback != nil {
+			delay = int64(s.Fallback.GetDelayTime(ctx))
+		} else {
+			delay = int64(s.Period)
+		}
+	}
+	if s.Cap > 0 && delay > int64(s.Cap) {
+		return s.Cap
 	}
+	return int(delay)
+}
 
-	return &RetryCondition{
-		MaxAttempts: maxAttempts,
-		Backoff:     backoff,
-		Exception:   exception,
-		ErrorCode:   errorCode,
-		MaxDelay:    maxDelay,
+// RetryCondition holds the retry conditions, it applies to an attempt when any of
+// Exception, ErrorCode, StatusCode, ErrorClass or Predicate matches
+type RetryCondition struct {
+	MaxAttempts int
+	Backoff     BackoffPolicy
+	Exception   []string
+	ErrorCode   []string
+	MaxDelay    int
+	// StatusCode matches the status code of the response, or of a ResponseError
+	StatusCode []StatusCodeRange
+	// ErrorClass matches the network errors of the attempt, wrapped or not
+	ErrorClass []ErrorClass
+	// Predicate matches when it returns true, it can not be read from or written to a config
+	Predicate func(ctx *RetryPolicyContext) bool `json:"-" xml:"-"`
+}
+
+// NewRetryCondition builds a RetryCondition from a map, skipping the options of the wrong type.
+// Use ParseRetryCondition to have them reported.
+func NewRetryCondition(condition map[string]interface{}) *RetryCondition {
+	result, err := parseRetryCondition(condition, false)
+	if err != nil {
+		result, _ = parseRetryCondition(nil, false)
 	}
+	return result
 }
 
-// RetryOptions holds the retry options
+// RetryOptions holds the retry options, Budget may be shared by several RetryOptions
 type RetryOptions struct {
 	Retryable        bool
 	RetryCondition   []*RetryCondition
 	NoRetryCondition []*RetryCondition
+	Budget           *RetryBudget
 }
 
+// NewRetryOptions builds RetryOptions from a map, skipping the options of the wrong type.
+// Use ParseRetryOptions to have them reported.
 func NewRetryOptions(options map[string]interface{}) *RetryOptions {
-	retryConditions := make([]*RetryCondition, 0)
-	for _, cond := range options["retryCondition"].([]interface{}) {
-		condition := NewRetryCondition(cond.(map[string]interface{}))
-		retryConditions = append(retryConditions, condition)
-	}
-
-	noRetryConditions := make([]*RetryCondition, 0)
-	for _, cond := range options["noRetryCondition"].([]interface{}) {
-		condition := NewRetryCondition(cond.(map[string]interface{}))
-		noRetryConditions = append(noRetryConditions, condition)
-	}
-
-	return &RetryOptions{
-		Retryable:        options["retryable"].(bool),
-		RetryCondition:   retryConditions,
-		NoRetryCondition: noRetryConditions,
+	result, err := parseRetryOptions(options, false)
+	if err != nil {
+		result, _ = parseRetryOptions(nil, false)
 	}
+	return result
 }
 
-// shouldRetry determines if a retry should be attempted
+// shouldRetry determines if a retry should be attempted,
+// a retry allowed by the conditions is withdrawn from the Budget of options
 func ShouldRetry(options *RetryOptions, ctx *RetryPolicyContext) bool {
 	if ctx.RetriesAttempted == 0 {
 		return true
@@ -266,48 +438,47 @@ func ShouldRetry(options *RetryOptions, ctx *RetryPolicyContext) bool {
 		return false
 	}
 
-	retriesAttempted := ctx.RetriesAttempted
-	ex := ctx.Exception
-	if baseErr, ok := ex.(BaseError); ok {
-		conditions := options.NoRetryCondition
-
-		for _, condition := range conditions {
-			for _, exc := range condition.Exception {
-				if exc == StringValue(baseErr.GetName()) {
-					return false
-				}
-			}
-			for _, code := range condition.ErrorCode {
-				if code == StringValue(baseErr.GetCode()) {
-					return false
-				}
-			}
+	for _, condition := range options.NoRetryCondition {
+		if condition.matches(ctx) {
+			return false
 		}
+	}
 
-		conditions = options.RetryCondition
-		for _, condition := range conditions {
-			for _, exc := range condition.Exception {
-				if exc == StringValue(baseErr.GetName()) {
-					if retriesAttempted >= condition.MaxAttempts {
-						return false
-					}
-					return true
-				}
-			}
-			for _, code := range condition.ErrorCode {
-				if code == StringValue(baseErr.GetCode()) {
-					if retriesAttempted >= condition.MaxAttempts {
-						return false
-					}
-					return true
-				}
+	for _, condition := range options.RetryCondition {
+		if condition.matches(ctx) {
+			if ctx.RetriesAttempted >= condition.MaxAttempts {
+				return false
 			}
+			return options.Budget.Withdraw()
 		}
 	}
 
 	return false
 }
 
+// recordBudgetSuccess adds the response to the budget of options unless it is a failure,
+// a server error or a response a retry condition applies to. DoRequestWithCtx calls it for
+// every response, so that the loops built on ShouldRetry feed the budget too.
+func recordBudgetSuccess(options *RetryOptions, request *Request, response *Response) {
+	if options == nil || options.Budget == nil || IntValue(response.StatusCode) >= http.StatusInternalServerError {
+		return
+	}
+	if matchesRetryCondition(options, &RetryPolicyContext{HttpRequest: request, HttpResponse: response}) {
+		return
+	}
+	options.Budget.RecordSuccess()
+}
+
+// matchesRetryCondition reports whether a retry condition applies to ctx, attempts and budget aside
+func matchesRetryCondition(options *RetryOptions, ctx *RetryPolicyContext) bool {
+	for _, condition := range options.RetryCondition {
+		if condition.matches(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
 // getBackoffDelay calculates backoff delay
 func GetBackoffDelay(options *RetryOptions, ctx *RetryPolicyContext) int {
 	if ctx.RetriesAttempted == 0 {
@@ -318,52 +489,165 @@ func GetBackoffDelay(options *RetryOptions, ctx *RetryPolicyContext) int {
 		return MIN_DELAY_TIME
 	}
 
-	ex := ctx.Exception
-	conditions := options.RetryCondition
-	if baseErr, ok := ex.(BaseError); ok {
-		for _, condition := range conditions {
-			for _, exc := range condition.Exception {
-				if exc == StringValue(baseErr.GetName()) {
-					maxDelay := condition.MaxDelay
-					// Simulated "retryAfter" from an error response
-					if respErr, ok := ex.(ResponseError); ok {
-						retryAfter := Int64Value(respErr.GetRetryAfter())
-						if retryAfter != 0 {
-							return min(int(retryAfter), maxDelay)
-						}
-					}
-					// This would be set properly based on your error handling
-
-					if condition.Backoff == nil {
-						return MIN_DELAY_TIME
-					}
-					return min(condition.Backoff.GetDelayTime(ctx), maxDelay)
-				}
+	for _, condition := range options.RetryCondition {
+		if !condition.matches(ctx) {
+			continue
+		}
+		maxDelay := condition.MaxDelay
+		// the delay the server asked for wins over the backoff policy
+		if respErr, ok := ctx.Exception.(ResponseError); ok {
+			retryAfter := Int64Value(respErr.GetRetryAfter())
+			if retryAfter != 0 {
+				return min(int(retryAfter), maxDelay)
 			}
+		}
 
-			for _, code := range condition.ErrorCode {
-				if code == StringValue(baseErr.GetCode()) {
-					maxDelay := condition.MaxDelay
-					// Simulated "retryAfter" from an error response
-					if respErr, ok := ex.(ResponseError); ok {
-						retryAfter := Int64Value(respErr.GetRetryAfter())
-						if retryAfter != 0 {
-							return min(int(retryAfter), maxDelay)
-						}
-					}
-
-					if condition.Backoff == nil {
-						return MIN_DELAY_TIME
-					}
-
-					return min(condition.Backoff.GetDelayTime(ctx), maxDelay)
-				}
-			}
+		if condition.Backoff == nil {
+			return MIN_DELAY_TIME
 		}
+		return min(condition.Backoff.GetDelayTime(ctx), maxDelay)
 	}
 	return MIN_DELAY_TIME
 }
 
+// RetryError is returned by DoRequestWithRetry when no attempt succeeded
+type RetryError struct {
+	// Attempts holds the error of every attempt, in order
+	Attempts []error
+	// Err is the error that ended the loop, either the last attempt or ctx.Err()
+	Err error
+}
+
+func (err *RetryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "request failed after %d attempt(s):", len(err.Attempts))
+	for i, attemptErr := range err.Attempts {
+		fmt.Fprintf(&b, "\n   attempt %d: %s", i+1, attemptErr.Error())
+	}
+	if len(err.Attempts) == 0 || err.Err != err.Attempts[len(err.Attempts)-1] {
+		fmt.Fprintf(&b, "\n   stopped: %v", err.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the error that ended the retry loop
+func (err *RetryError) Unwrap() error {
+	return err.Err
+}
+
+// DoRequestWithRetry sends the request and retries it as described by runtimeObject.RetryOptions.
+// The backoff between attempts honours ctx cancellation, and a seekable body is rewound
+// before every retry, a seekable io.ReadCloser such as an *os.File is closed once the
+// retries are over. A body that can not be rewound is sent only once. A response matched
+// by a retry condition, by its status code for instance, is closed and the request retried,
+// the response of the last attempt is returned as is.
+func DoRequestWithRetry(ctx context.Context, request *Request, runtimeObject *RuntimeObject) (*Response, error) {
+	if runtimeObject == nil {
+		runtimeObject = &RuntimeObject{}
+	}
+	rewind, replayable := bodyRewinder(request.Body)
+	if closer, ok := request.Body.(io.ReadCloser); ok && replayable && request.Body != http.NoBody {
+		// the transport closes the body it sent, the body is only closed once the retries are over
+		body := request.Body
+		request.Body = &noCloseBody{ReadSeeker: body.(io.ReadSeeker)}
+		defer func() {
+			request.Body = body
+			closer.Close()
+		}()
+	}
+	retryErr := &RetryError{}
+	retryPolicyContext := &RetryPolicyContext{
+		HttpRequest: request,
+	}
+	delay := 0
+	for {
+		if retryPolicyContext.RetriesAttempted > 0 {
+			delay = GetBackoffDelay(runtimeObject.RetryOptions, retryPolicyContext)
+			if retryPolicyContext.HttpResponse != nil {
+				discardResponse(retryPolicyContext.HttpResponse)
+			}
+			if err := sleepWithContext(ctx, time.Duration(delay)*time.Millisecond); err != nil {
+				retryErr.Err = err
+				return nil, retryErr
+			}
+			if err := rewind(); err != nil {
+				retryErr.Err = err
+				return nil, retryErr
+			}
+		}
+
+		response, err := DoRequestWithCtx(ctx, request, runtimeObject)
+		next := &RetryPolicyContext{
+			RetriesAttempted: retryPolicyContext.RetriesAttempted + 1,
+			HttpRequest:      request,
+			HttpResponse:     response,
+			Exception:        err,
+			PreviousDelay:    delay,
+		}
+		if err == nil {
+			if ctx.Err() != nil || !replayable || !ShouldRetry(runtimeObject.RetryOptions, next) {
+				return response, nil
+			}
+			retryErr.Attempts = append(retryErr.Attempts, fmt.Errorf("retryable response with status code %d", IntValue(response.StatusCode)))
+		} else {
+			retryErr.Attempts = append(retryErr.Attempts, err)
+			retryErr.Err = err
+			if ctx.Err() != nil || !replayable || !ShouldRetry(runtimeObject.RetryOptions, next) {
+				return nil, retryErr
+			}
+		}
+		retryPolicyContext = next
+	}
+}
+
+// discardResponse drains and closes the body of a response that is retried,
+// so that its connection is reused
+func discardResponse(response *Response) {
+	if response.Body == nil {
+		return
+	}
+	io.CopyN(ioutil.Discard, response.Body, 4096)
+	response.Body.Close()
+}
+
+// bodyRewinder reports whether body can be sent again and returns the func restoring it
+func bodyRewinder(body io.Reader) (func() error, bool) {
+	if body == nil || body == http.NoBody {
+		return func() error { return nil }, true
+	}
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return nil, false
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, false
+	}
+	return func() error {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}, true
+}
+
+// noCloseBody hides the Close of a seekable body so that it can be sent again
+type noCloseBody struct {
+	io.ReadSeeker
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // helper function to find the minimum of two values
 func min(a, b int) int {
 	if a < b {
@@ -0,0 +1,132 @@
+package dara
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit holds the x-ratelimit-* headers of a throttled response
+type RateLimit struct {
+	Limit     *int64
+	Remaining *int64
+	// Reset is the delay in milliseconds until the limit is reset
+	Reset *int64
+}
+
+// epochThreshold tells an epoch in seconds from a delay in seconds in x-ratelimit-reset
+const epochThreshold = 1000000000
+
+// ParseRetryAfter parses a Retry-After value, as delay-seconds or as an HTTP-date,
+// into the delay in milliseconds from now. A date in the past is a delay of zero.
+func ParseRetryAfter(value string, now time.Time) (int64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return seconds * 1000, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	delay := date.Sub(now)
+	if delay < 0 {
+		return 0, true
+	}
+	return int64(delay / time.Millisecond), true
+}
+
+// ParseRateLimit parses the x-ratelimit-limit, x-ratelimit-remaining and x-ratelimit-reset
+// headers, or their ratelimit-* spelling, it returns nil when none is set. The reset is
+// either a delay or a unix time in seconds.
+func ParseRateLimit(headers map[string]string, now time.Time) *RateLimit {
+	lookup := func(name string) *int64 {
+		for _, key := range []string{"x-ratelimit-" + name, "ratelimit-" + name} {
+			if value, ok := headers[key]; ok {
+				if number, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					return Int64(int64(number))
+				}
+			}
+		}
+		return nil
+	}
+	rateLimit := &RateLimit{
+		Limit:     lookup("limit"),
+		Remaining: lookup("remaining"),
+		Reset:     lookup("reset"),
+	}
+	if rateLimit.Limit == nil && rateLimit.Remaining == nil && rateLimit.Reset == nil {
+		return nil
+	}
+	if rateLimit.Reset != nil {
+		reset := *rateLimit.Reset
+		if reset >= epochThreshold {
+			reset = reset - now.Unix()
+		}
+		if reset < 0 {
+			reset = 0
+		}
+		rateLimit.Reset = Int64(reset * 1000)
+	}
+	return rateLimit
+}
+
+// retryAfterFromHeaders returns the delay in milliseconds the server asked for, from
+// Retry-After or else from the reset of an exhausted rate limit
+func retryAfterFromHeaders(headers map[string]string, rateLimit *RateLimit, now time.Time) *int64 {
+	if delay, ok := ParseRetryAfter(headers["retry-after"], now); ok {
+		return Int64(delay)
+	}
+	if rateLimit != nil && rateLimit.Reset != nil && rateLimit.Remaining != nil && *rateLimit.Remaining <= 0 {
+		return Int64(*rateLimit.Reset)
+	}
+	return nil
+}
+
+// normalizeHeaders lower-cases the keys of the headers of a Response or an http.Header,
+// keeping the first value of every header
+func normalizeHeaders(headers interface{}) map[string]string {
+	result := make(map[string]string)
+	switch h := headers.(type) {
+	case map[string]*string:
+		for key, value := range h {
+			if value != nil {
+				result[strings.ToLower(key)] = *value
+			}
+		}
+	case map[string]string:
+		for key, value := range h {
+			result[strings.ToLower(key)] = value
+		}
+	case http.Header:
+		for key, values := range h {
+			if len(values) > 0 {
+				result[strings.ToLower(key)] = values[0]
+			}
+		}
+	case map[string][]string:
+		for key, values := range h {
+			if len(values) > 0 {
+				result[strings.ToLower(key)] = values[0]
+			}
+		}
+	case map[string]interface{}:
+		for key, value := range h {
+			switch v := value.(type) {
+			case string:
+				result[strings.ToLower(key)] = v
+			case *string:
+				if v != nil {
+					result[strings.ToLower(key)] = *v
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package dara
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	delay, ok := ParseRetryAfter("120", now)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, int64(120000), delay)
+
+	delay, ok = ParseRetryAfter("Tue, 02 Jan 2024 03:04:15 GMT", now)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, int64(10000), delay)
+
+	delay, ok = ParseRetryAfter("Tue, 02 Jan 2024 03:00:00 GMT", now)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, int64(0), delay)
+
+	for _, value := range []string{"", "-1", "soon"} {
+		_, ok = ParseRetryAfter(value, now)
+		utils.AssertEqual(t, false, ok)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	rateLimit := ParseRateLimit(map[string]string{
+		"x-ratelimit-limit":     "100",
+		"x-ratelimit-remaining": "0",
+		"x-ratelimit-reset":     "30",
+	}, now)
+	utils.AssertEqual(t, int64(100), Int64Value(rateLimit.Limit))
+	utils.AssertEqual(t, int64(0), Int64Value(rateLimit.Remaining))
+	utils.AssertEqual(t, int64(30000), Int64Value(rateLimit.Reset))
+
+	// the reset may be a unix time
+	rateLimit = ParseRateLimit(map[string]string{"ratelimit-reset": "1700000005"}, now)
+	utils.AssertNil(t, rateLimit.Limit)
+	utils.AssertEqual(t, int64(5000), Int64Value(rateLimit.Reset))
+
+	utils.AssertNil(t, ParseRateLimit(map[string]string{"x-ratelimit-limit": "many"}, now))
+}
+
+func TestSDKErrorRetryAfter(t *testing.T) {
+	response := NewResponse(&http.Response{
+		StatusCode: 429,
+		Header: http.Header{
+			"Retry-After": []string{"3"},
+		},
+	})
+	err := NewSDKError(map[string]interface{}{
+		"code":       "Throttling",
+		"statusCode": IntValue(response.StatusCode),
+		"headers":    response.Headers,
+		"data": map[string]interface{}{
+			"RequestId": "req-1",
+		},
+	})
+	var respErr ResponseError = err
+	utils.AssertEqual(t, int64(3000), Int64Value(respErr.GetRetryAfter()))
+	utils.AssertEqual(t, 429, IntValue(respErr.GetStatusCode()))
+	utils.AssertEqual(t, "BaseError", StringValue(respErr.GetName()))
+	utils.AssertEqual(t, "req-1", respErr.GetData()["RequestId"])
+	utils.AssertNil(t, err.RateLimit)
+
+	// an exhausted rate limit tells when to retry
+	err = NewSDKError(map[string]interface{}{
+		"code": "Throttling",
+		"headers": http.Header{
+			"X-Ratelimit-Remaining": []string{"0"},
+			"X-Ratelimit-Reset":     []string{"2"},
+		},
+	})
+	utils.AssertEqual(t, int64(2000), Int64Value(err.GetRetryAfter()))
+	utils.AssertEqual(t, int64(0), Int64Value(err.RateLimit.Remaining))
+
+	err = NewSDKError(map[string]interface{}{
+		"code":       "Throttling",
+		"retryAfter": 1500,
+	})
+	utils.AssertEqual(t, int64(1500), Int64Value(err.GetRetryAfter()))
+
+	err = NewSDKError(map[string]interface{}{
+		"code": "Throttling",
+		"data": "not a map",
+	})
+	utils.AssertNil(t, err.GetRetryAfter())
+	utils.AssertNil(t, err.GetData())
+	err.Data = String(`{"Message":"slow down"}`)
+	utils.AssertEqual(t, "slow down", err.GetData()["Message"])
+
+	// the server directed delay drives the backoff, capped by MaxDelay
+	options := &RetryOptions{
+		Retryable: true,
+		RetryCondition: []*RetryCondition{
+			{MaxAttempts: 3, ErrorCode: []string{"Throttling"}, Backoff: &FixedBackoffPolicy{Period: 100}, MaxDelay: 5000},
+		},
+	}
+	ctx := &RetryPolicyContext{
+		RetriesAttempted: 1,
+		Exception: NewSDKError(map[string]interface{}{
+			"code":    "Throttling",
+			"headers": map[string]string{"Retry-After": "4"},
+		}),
+	}
+	utils.AssertEqual(t, true, ShouldRetry(options, ctx))
+	utils.AssertEqual(t, 4000, GetBackoffDelay(options, ctx))
+	options.RetryCondition[0].MaxDelay = 1000
+	utils.AssertEqual(t, 1000, GetBackoffDelay(options, ctx))
+}
@@ -0,0 +1,133 @@
+package dara
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults of the RetryBudgetOptions left unset
+const (
+	DefaultRetryBudgetRatio      = 0.1
+	DefaultRetryBudgetMinRetries = 10
+	DefaultRetryBudgetWindow     = 10 * time.Second
+)
+
+const retryBudgetBuckets = 10
+
+// RetryBudgetOptions configures a RetryBudget, zero values take the defaults.
+// Within any Window, the retries are limited to MinRetries plus Ratio times the successful calls.
+type RetryBudgetOptions struct {
+	Ratio      float64
+	MinRetries int
+	Window     time.Duration
+	Clock      Clock
+}
+
+type retryBudgetBucket struct {
+	slot      int64
+	successes int
+	retries   int
+}
+
+// RetryBudget limits the retries of every RetryOptions sharing it to a share of the
+// successful calls, so that a broad outage does not turn every caller into a retry storm
+type RetryBudget struct {
+	mu         sync.Mutex
+	ratio      float64
+	minRetries int
+	width      time.Duration
+	clock      Clock
+	buckets    [retryBudgetBuckets]retryBudgetBucket
+}
+
+// NewRetryBudget creates a RetryBudget, options may be nil to take the defaults
+func NewRetryBudget(options *RetryBudgetOptions) *RetryBudget {
+	opts := RetryBudgetOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Ratio <= 0 {
+		opts.Ratio = DefaultRetryBudgetRatio
+	}
+	if opts.MinRetries <= 0 {
+		opts.MinRetries = DefaultRetryBudgetMinRetries
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultRetryBudgetWindow
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	width := opts.Window / retryBudgetBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return &RetryBudget{
+		ratio:      opts.Ratio,
+		minRetries: opts.MinRetries,
+		width:      width,
+		clock:      opts.Clock,
+	}
+}
+
+// bucket returns the bucket of the current slot, it must be called with the lock held
+func (budget *RetryBudget) bucket(slot int64) *retryBudgetBucket {
+	bucket := &budget.buckets[slot%retryBudgetBuckets]
+	if bucket.slot != slot {
+		*bucket = retryBudgetBucket{slot: slot}
+	}
+	return bucket
+}
+
+// totals sums the buckets of the window ending at slot, it must be called with the lock held
+func (budget *RetryBudget) totals(slot int64) (successes, retries int) {
+	for _, bucket := range budget.buckets {
+		if bucket.slot <= slot && slot-bucket.slot < retryBudgetBuckets {
+			successes += bucket.successes
+			retries += bucket.retries
+		}
+	}
+	return
+}
+
+func (budget *RetryBudget) slot() int64 {
+	return budget.clock.Now().UnixNano() / int64(budget.width)
+}
+
+// RecordSuccess adds a successful call to the budget
+func (budget *RetryBudget) RecordSuccess() {
+	if budget == nil {
+		return
+	}
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	budget.bucket(budget.slot()).successes++
+}
+
+// Withdraw takes a retry from the budget and reports whether one was left,
+// a nil budget always allows the retry
+func (budget *RetryBudget) Withdraw() bool {
+	if budget == nil {
+		return true
+	}
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	slot := budget.slot()
+	successes, retries := budget.totals(slot)
+	if float64(retries) >= float64(budget.minRetries)+budget.ratio*float64(successes) {
+		return false
+	}
+	budget.bucket(slot).retries++
+	return true
+}
+
+// Stats returns the successful calls and the retries counted in the current window,
+// zero for a nil budget
+func (budget *RetryBudget) Stats() (successes, retries int) {
+	if budget == nil {
+		return 0, 0
+	}
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	return budget.totals(budget.slot())
+}
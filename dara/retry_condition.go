@@ -0,0 +1,185 @@
+package dara
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// StatusCodeRange matches the status codes from From to To, both included
+type StatusCodeRange struct {
+	From int
+	To   int
+}
+
+// StatusCode returns the range matching the single status code
+func StatusCode(code int) StatusCodeRange {
+	return StatusCodeRange{From: code, To: code}
+}
+
+// ParseStatusCodeRange parses a status code ("429"), a range ("500-599") or a class ("5xx")
+func ParseStatusCodeRange(value string) (StatusCodeRange, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 3 && strings.HasSuffix(strings.ToLower(value), "xx") {
+		class, err := strconv.Atoi(value[:1])
+		if err == nil && class >= 1 && class <= 5 {
+			return StatusCodeRange{From: class * 100, To: class*100 + 99}, nil
+		}
+	} else if parts := strings.SplitN(value, "-", 2); len(parts) == 2 {
+		from, fromErr := strconv.Atoi(strings.TrimSpace(parts[0]))
+		to, toErr := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if fromErr == nil && toErr == nil {
+			return StatusCodeRange{From: from, To: to}, nil
+		}
+	} else if code, err := strconv.Atoi(value); err == nil {
+		return StatusCode(code), nil
+	}
+	return StatusCodeRange{}, fmt.Errorf("%q is not a status code, a range or a class", value)
+}
+
+// String formats the range the way ParseStatusCodeRange reads it
+func (r StatusCodeRange) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// Contains reports whether code is in the range
+func (r StatusCodeRange) Contains(code int) bool {
+	return code >= r.From && code <= r.To
+}
+
+// ErrorClass is a class of network errors a RetryCondition may match
+type ErrorClass string
+
+const (
+	// ErrorClassTimeout matches the timeouts of the connection or of the response
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassDNS matches a failed lookup of the host
+	ErrorClassDNS ErrorClass = "dns"
+	// ErrorClassConnectionReset matches a connection reset by the peer or a broken pipe
+	ErrorClassConnectionReset ErrorClass = "reset"
+	// ErrorClassConnectionRefused matches a connection refused by the host
+	ErrorClassConnectionRefused ErrorClass = "refused"
+	// ErrorClassTLS matches a failed TLS handshake or certificate verification
+	ErrorClassTLS ErrorClass = "tls"
+	// ErrorClassEOF matches a connection closed before the response was complete
+	ErrorClassEOF ErrorClass = "eof"
+)
+
+var errorClasses = []ErrorClass{
+	ErrorClassTimeout,
+	ErrorClassDNS,
+	ErrorClassConnectionReset,
+	ErrorClassConnectionRefused,
+	ErrorClassTLS,
+	ErrorClassEOF,
+}
+
+func (class ErrorClass) valid() bool {
+	for _, known := range errorClasses {
+		if class == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether err, or an error it wraps, is of the class
+func (class ErrorClass) Matches(err error) bool {
+	if err == nil {
+		return false
+	}
+	// the category of a TransportError covers the failures with no typed cause
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		switch {
+		case class == ErrorClassTimeout && transportErr.Timeout(),
+			class == ErrorClassDNS && transportErr.Category == TransportErrorDNS,
+			class == ErrorClassTLS && transportErr.Category == TransportErrorTLS:
+			return true
+		}
+	}
+	switch class {
+	case ErrorClassTimeout:
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return true
+		}
+		return errors.Is(err, context.DeadlineExceeded)
+	case ErrorClassDNS:
+		var dnsErr *net.DNSError
+		return errors.As(err, &dnsErr)
+	case ErrorClassConnectionReset:
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+	case ErrorClassConnectionRefused:
+		return errors.Is(err, syscall.ECONNREFUSED)
+	case ErrorClassTLS:
+		var recordErr tls.RecordHeaderError
+		var authorityErr x509.UnknownAuthorityError
+		var invalidErr x509.CertificateInvalidError
+		var hostnameErr x509.HostnameError
+		if errors.As(err, &recordErr) || errors.As(err, &authorityErr) ||
+			errors.As(err, &invalidErr) || errors.As(err, &hostnameErr) {
+			return true
+		}
+		// the alerts sent by the server have no exported type
+		return strings.Contains(err.Error(), "tls: ")
+	case ErrorClassEOF:
+		return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return false
+}
+
+// matches reports whether the condition applies to the attempt described by ctx
+func (condition *RetryCondition) matches(ctx *RetryPolicyContext) bool {
+	ex := ctx.Exception
+	var baseErr BaseError
+	if ex != nil && errors.As(ex, &baseErr) {
+		for _, exc := range condition.Exception {
+			if exc == StringValue(baseErr.GetName()) {
+				return true
+			}
+		}
+		for _, code := range condition.ErrorCode {
+			if code == StringValue(baseErr.GetCode()) {
+				return true
+			}
+		}
+	}
+	if len(condition.StatusCode) > 0 {
+		if statusCode, ok := statusCodeOf(ctx); ok {
+			for _, r := range condition.StatusCode {
+				if r.Contains(statusCode) {
+					return true
+				}
+			}
+		}
+	}
+	for _, class := range condition.ErrorClass {
+		if class.Matches(ex) {
+			return true
+		}
+	}
+	return condition.Predicate != nil && condition.Predicate(ctx)
+}
+
+// statusCodeOf returns the status code of the response, or else of the ResponseError
+func statusCodeOf(ctx *RetryPolicyContext) (int, bool) {
+	if ctx.HttpResponse != nil && ctx.HttpResponse.StatusCode != nil {
+		return *ctx.HttpResponse.StatusCode, true
+	}
+	var respErr ResponseError
+	if ctx.Exception != nil && errors.As(ctx.Exception, &respErr) && respErr.GetStatusCode() != nil {
+		return *respErr.GetStatusCode(), true
+	}
+	return 0, false
+}
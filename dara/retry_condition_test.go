@@ -0,0 +1,225 @@
+package dara
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestParseStatusCodeRange(t *testing.T) {
+	tests := map[string]StatusCodeRange{
+		"429":       {From: 429, To: 429},
+		"500-504":   {From: 500, To: 504},
+		" 5xx ":     {From: 500, To: 599},
+		"4XX":       {From: 400, To: 499},
+		"502 - 503": {From: 502, To: 503},
+	}
+	for value, expected := range tests {
+		r, err := ParseStatusCodeRange(value)
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, expected, r)
+	}
+	for _, value := range []string{"", "9xx", "abc", "500-"} {
+		_, err := ParseStatusCodeRange(value)
+		utils.AssertNotNil(t, err)
+	}
+	utils.AssertEqual(t, "500-599", StatusCodeRange{From: 500, To: 599}.String())
+	utils.AssertEqual(t, "429", StatusCode(429).String())
+	utils.AssertEqual(t, true, StatusCode(429).Contains(429))
+	utils.AssertEqual(t, false, StatusCode(429).Contains(430))
+}
+
+func TestErrorClassMatches(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	dns := &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}
+	tests := []struct {
+		class ErrorClass
+		err   error
+	}{
+		{ErrorClassTimeout, timeoutErr{}},
+		{ErrorClassTimeout, fmt.Errorf("send: %w", context.DeadlineExceeded)},
+		{ErrorClassDNS, fmt.Errorf("dial: %w", dns)},
+		{ErrorClassConnectionReset, reset},
+		{ErrorClassConnectionRefused, refused},
+		{ErrorClassTLS, x509.UnknownAuthorityError{}},
+		{ErrorClassTLS, errors.New("remote error: tls: handshake failure")},
+		{ErrorClassEOF, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		for _, class := range errorClasses {
+			utils.AssertEqual(t, class == tt.class, class.Matches(tt.err))
+		}
+	}
+	utils.AssertEqual(t, false, ErrorClassTimeout.Matches(nil))
+	utils.AssertEqual(t, false, ErrorClass("other").Matches(reset))
+}
+
+func TestShouldRetryWithConditions(t *testing.T) {
+	options := &RetryOptions{
+		Retryable: true,
+		RetryCondition: []*RetryCondition{
+			{MaxAttempts: 3, StatusCode: []StatusCodeRange{StatusCode(429), {From: 500, To: 599}}, Backoff: &FixedBackoffPolicy{Period: 300}, MaxDelay: 1000},
+			{MaxAttempts: 3, ErrorClass: []ErrorClass{ErrorClassTimeout, ErrorClassConnectionReset}, Backoff: &FixedBackoffPolicy{Period: 200}, MaxDelay: 1000},
+			{MaxAttempts: 2, Predicate: func(ctx *RetryPolicyContext) bool {
+				return ctx.Exception != nil && ctx.Exception.Error() == "retry me"
+			}, Backoff: &FixedBackoffPolicy{Period: 100}, MaxDelay: 1000},
+		},
+		NoRetryCondition: []*RetryCondition{
+			{StatusCode: []StatusCodeRange{StatusCode(501)}},
+		},
+	}
+	response := func(statusCode int) *Response {
+		return &Response{StatusCode: Int(statusCode)}
+	}
+
+	ctx := &RetryPolicyContext{RetriesAttempted: 1, HttpResponse: response(503)}
+	utils.AssertEqual(t, true, ShouldRetry(options, ctx))
+	utils.AssertEqual(t, 300, GetBackoffDelay(options, ctx))
+	ctx = &RetryPolicyContext{RetriesAttempted: 1, HttpResponse: response(200)}
+	utils.AssertEqual(t, false, ShouldRetry(options, ctx))
+	ctx = &RetryPolicyContext{RetriesAttempted: 1, HttpResponse: response(501)}
+	utils.AssertEqual(t, false, ShouldRetry(options, ctx))
+	ctx = &RetryPolicyContext{RetriesAttempted: 3, HttpResponse: response(429)}
+	utils.AssertEqual(t, false, ShouldRetry(options, ctx))
+
+	// the status code of a ResponseError matches as well
+	ctx = &RetryPolicyContext{RetriesAttempted: 1, Exception: NewSDKError(map[string]interface{}{
+		"code":       "Throttling",
+		"statusCode": 429,
+	})}
+	utils.AssertEqual(t, true, ShouldRetry(options, ctx))
+	utils.AssertEqual(t, 300, GetBackoffDelay(options, ctx))
+
+	// errors which are not a BaseError are retried by class or predicate
+	ctx = &RetryPolicyContext{RetriesAttempted: 1, Exception: fmt.Errorf("read body: %w", timeoutErr{})}
+	utils.AssertEqual(t, true, ShouldRetry(options, ctx))
+	utils.AssertEqual(t, 200, GetBackoffDelay(options, ctx))
+	ctx = &RetryPolicyContext{RetriesAttempted: 1, Exception: errors.New("retry me")}
+	utils.AssertEqual(t, true, ShouldRetry(options, ctx))
+	utils.AssertEqual(t, 100, GetBackoffDelay(options, ctx))
+	ctx = &RetryPolicyContext{RetriesAttempted: 2, Exception: errors.New("retry me")}
+	utils.AssertEqual(t, false, ShouldRetry(options, ctx))
+	ctx = &RetryPolicyContext{RetriesAttempted: 1, Exception: errors.New("other")}
+	utils.AssertEqual(t, false, ShouldRetry(options, ctx))
+	utils.AssertEqual(t, MIN_DELAY_TIME, GetBackoffDelay(options, ctx))
+
+	// a wrapped BaseError is matched by name and code
+	options.RetryCondition = append(options.RetryCondition, &RetryCondition{MaxAttempts: 3, ErrorCode: []string{"Throttling"}})
+	ctx = &RetryPolicyContext{RetriesAttempted: 1, Exception: fmt.Errorf("call: %w", &retryTestErr{name: "AErr", code: "Throttling"})}
+	utils.AssertEqual(t, true, ShouldRetry(options, ctx))
+}
+
+func TestDoRequestWithRetryStatusCode(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	statusCodes := []int{503, 429, 200}
+	calls := 0
+	var bodies []*closeRecorder
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			statusCode := statusCodes[calls%len(statusCodes)]
+			calls++
+			if statusCode == 0 {
+				return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+			}
+			res, err := mockResponse(statusCode, fmt.Sprintf("attempt %d", calls), nil)
+			body := &closeRecorder{ReadCloser: res.Body}
+			bodies = append(bodies, body)
+			res.Body = body
+			return res, err
+		}
+	}
+
+	runtime := &RuntimeObject{
+		RetryOptions: &RetryOptions{
+			Retryable: true,
+			RetryCondition: []*RetryCondition{
+				new(RetryCondition).SetMaxAttempts(3).SetMaxDelay(1).SetBackoff(&FixedBackoffPolicy{Period: 1}).
+					SetStatusCode(StatusCode(429), StatusCodeRange{From: 500, To: 599}).
+					SetErrorClass(ErrorClassConnectionReset),
+			},
+		},
+	}
+	resp, err := DoRequestWithRetry(context.Background(), NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, IntValue(resp.StatusCode))
+	body, err := resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "attempt 3", string(body))
+	utils.AssertEqual(t, 3, calls)
+	// the bodies of the retried responses are closed
+	utils.AssertEqual(t, true, bodies[0].closed)
+	utils.AssertEqual(t, true, bodies[1].closed)
+
+	// the last response is returned once the attempts are exhausted
+	calls, bodies = 0, nil
+	statusCodes = []int{503}
+	resp, err = DoRequestWithRetry(context.Background(), NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 503, IntValue(resp.StatusCode))
+	body, _ = resp.ReadBody()
+	utils.AssertEqual(t, "attempt 3", string(body))
+	utils.AssertEqual(t, 3, calls)
+
+	// plain network errors are retried by class
+	calls, bodies = 0, nil
+	statusCodes = []int{0, 0, 0}
+	_, err = DoRequestWithRetry(context.Background(), NewRequest(), runtime)
+	retryErr := err.(*RetryError)
+	utils.AssertEqual(t, 3, len(retryErr.Attempts))
+	utils.AssertEqual(t, true, errors.Is(err, syscall.ECONNRESET))
+}
+
+type closeRecorder struct {
+	io.ReadCloser
+	closed bool
+}
+
+func (body *closeRecorder) Close() error {
+	body.closed = true
+	return body.ReadCloser.Close()
+}
+
+func TestParseRetryConditionMatchers(t *testing.T) {
+	condition, err := ParseRetryCondition(map[string]interface{}{
+		"statusCode": []interface{}{429, float64(503), "5xx"},
+		"errorClass": []interface{}{"timeout", "dns"},
+	})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, []StatusCodeRange{StatusCode(429), StatusCode(503), {From: 500, To: 599}}, condition.StatusCode)
+	utils.AssertEqual(t, []ErrorClass{ErrorClassTimeout, ErrorClassDNS}, condition.ErrorClass)
+
+	result, err := condition.ToMap()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, []string{"429", "503", "500-599"}, result["statusCode"])
+	utils.AssertEqual(t, []string{"timeout", "dns"}, result["errorClass"])
+
+	_, err = ParseRetryCondition(map[string]interface{}{"statusCode": []interface{}{"soon"}})
+	utils.AssertEqual(t, `invalid retry condition: statusCode: "soon" is not a status code, a range or a class`, err.Error())
+	_, err = ParseRetryCondition(map[string]interface{}{"statusCode": []interface{}{true}})
+	utils.AssertEqual(t, "invalid retry condition: statusCode: true (bool) is not a status code", err.Error())
+	_, err = ParseRetryCondition(map[string]interface{}{"statusCode": []interface{}{"599-500"}})
+	utils.AssertEqual(t, "invalid retry condition: statusCode 599-500 is not a range of status codes", err.Error())
+	_, err = ParseRetryCondition(map[string]interface{}{"errorClass": []interface{}{"slow"}})
+	utils.AssertEqual(t, `invalid retry condition: unknown errorClass "slow"`, err.Error())
+
+	// a predicate is a matcher of its own
+	condition = new(RetryCondition).SetPredicate(func(ctx *RetryPolicyContext) bool { return true })
+	utils.AssertNil(t, condition.Validate())
+}
@@ -0,0 +1,528 @@
+package dara
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseRetryOptions builds RetryOptions from a map decoded from JSON or YAML,
+// such as {"retryable": true, "retryCondition": [{"exception": ["Throttling"], "maxAttempts": 3}]}.
+// Unlike NewRetryOptions it reports missing, unknown and wrongly typed options.
+func ParseRetryOptions(options map[string]interface{}) (*RetryOptions, error) {
+	return parseRetryOptions(options, true)
+}
+
+// ParseRetryCondition builds a RetryCondition from a map decoded from JSON or YAML,
+// reporting unknown and wrongly typed options
+func ParseRetryCondition(condition map[string]interface{}) (*RetryCondition, error) {
+	return parseRetryCondition(condition, true)
+}
+
+// LoadRetryOptions decodes RetryOptions from their JSON form
+func LoadRetryOptions(data []byte) (*RetryOptions, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var options map[string]interface{}
+	if err := decoder.Decode(&options); err != nil {
+		return nil, fmt.Errorf("invalid retry options: %s", err)
+	}
+	return ParseRetryOptions(options)
+}
+
+// parseRetryOptions reports the first invalid option when strict,
+// otherwise it skips the invalid options
+func parseRetryOptions(options map[string]interface{}, strict bool) (*RetryOptions, error) {
+	result := &RetryOptions{
+		RetryCondition:   []*RetryCondition{},
+		NoRetryCondition: []*RetryCondition{},
+	}
+	options, err := normalizeConfigMap(options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry options: %s", err)
+	}
+	for _, key := range sortedKeys(options) {
+		value := options[key]
+		switch key {
+		case "retryable":
+			retryable, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("retryable must be a bool, got %T", value)
+				break
+			}
+			result.Retryable = retryable
+		case "retryCondition", "noRetryCondition":
+			var conditions []*RetryCondition
+			conditions, err = parseRetryConditions(key, value, strict)
+			if key == "retryCondition" {
+				result.RetryCondition = conditions
+			} else {
+				result.NoRetryCondition = conditions
+			}
+		case "budget":
+			if value == nil {
+				break
+			}
+			budget, ok := value.(*RetryBudget)
+			if !ok {
+				err = fmt.Errorf("budget must be a *RetryBudget, got %T", value)
+				break
+			}
+			result.Budget = budget
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil && strict {
+			return nil, fmt.Errorf("invalid retry options: %s", err)
+		}
+	}
+	if strict {
+		if _, ok := options["retryable"]; !ok {
+			return nil, fmt.Errorf("invalid retry options: retryable is required")
+		}
+		if err := result.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func parseRetryConditions(key string, value interface{}, strict bool) ([]*RetryCondition, error) {
+	conditions := []*RetryCondition{}
+	if value == nil {
+		return conditions, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return conditions, fmt.Errorf("%s must be a list, got %T", key, value)
+	}
+	for i, item := range items {
+		var condition *RetryCondition
+		var err error
+		switch v := item.(type) {
+		case *RetryCondition:
+			condition = v
+		case map[string]interface{}:
+			condition, err = parseRetryCondition(v, strict)
+		default:
+			err = fmt.Errorf("must be a map, got %T", item)
+		}
+		if err != nil {
+			if strict {
+				return conditions, fmt.Errorf("%s[%d]: %s", key, i, strings.TrimPrefix(err.Error(), "invalid retry condition: "))
+			}
+			if condition == nil {
+				continue
+			}
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+func parseRetryCondition(condition map[string]interface{}, strict bool) (*RetryCondition, error) {
+	result := &RetryCondition{
+		MaxAttempts: MAX_ATTEMPTS,
+		Exception:   []string{},
+		ErrorCode:   []string{},
+		MaxDelay:    MAX_DELAY_TIME,
+	}
+	condition, err := normalizeConfigMap(condition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry condition: %s", err)
+	}
+	for _, key := range sortedKeys(condition) {
+		value := condition[key]
+		switch key {
+		case "maxAttempts":
+			var maxAttempts int
+			if maxAttempts, err = toInt(value); err == nil {
+				result.MaxAttempts = maxAttempts
+			} else {
+				err = fmt.Errorf("maxAttempts: %s", err)
+			}
+		case "maxDelay":
+			var maxDelay int
+			if maxDelay, err = toInt(value); err == nil {
+				result.MaxDelay = maxDelay
+			} else {
+				err = fmt.Errorf("maxDelay: %s", err)
+			}
+		case "exception":
+			var exception []string
+			if exception, err = toStrings(value); err == nil {
+				result.Exception = exception
+			} else {
+				err = fmt.Errorf("exception: %s", err)
+			}
+		case "errorCode":
+			var errorCode []string
+			if errorCode, err = toStrings(value); err == nil {
+				result.ErrorCode = errorCode
+			} else {
+				err = fmt.Errorf("errorCode: %s", err)
+			}
+		case "statusCode":
+			var statusCode []StatusCodeRange
+			if statusCode, err = toStatusCodeRanges(value); err == nil {
+				result.StatusCode = statusCode
+			} else {
+				err = fmt.Errorf("statusCode: %s", err)
+			}
+		case "errorClass":
+			var errorClass []string
+			if errorClass, err = toStrings(value); err == nil {
+				for _, class := range errorClass {
+					result.ErrorClass = append(result.ErrorClass, ErrorClass(class))
+				}
+			} else {
+				err = fmt.Errorf("errorClass: %s", err)
+			}
+		case "backoff":
+			switch backoff := value.(type) {
+			case nil:
+			case BackoffPolicy:
+				result.Backoff = backoff
+			case map[string]interface{}:
+				if result.Backoff, err = BackoffPolicyFactory(backoff); err != nil {
+					err = fmt.Errorf("backoff: %s", err)
+				}
+			default:
+				err = fmt.Errorf("backoff must be a map, got %T", value)
+			}
+		default:
+			if strict {
+				err = fmt.Errorf("unknown option %q", key)
+			}
+		}
+		if err != nil && strict {
+			return nil, fmt.Errorf("invalid retry condition: %s", err)
+		}
+		err = nil
+	}
+	if strict {
+		if err := result.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// toStrings converts a list of strings decoded from code, JSON or YAML
+func toStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v (%T) is not a string", item, item)
+			}
+			result = append(result, str)
+		}
+		return result, nil
+	case nil:
+		return []string{}, nil
+	}
+	return nil, fmt.Errorf("%T is not a list of strings", value)
+}
+
+// toStatusCodeRanges converts a list of status codes, ranges and classes
+// such as [429, "500-504", "5xx"] decoded from code, JSON or YAML
+func toStatusCodeRanges(value interface{}) ([]StatusCodeRange, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []StatusCodeRange:
+		return v, nil
+	case []int:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []string:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []interface{}:
+		items = v
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%T is not a list of status codes", value)
+	}
+	result := make([]StatusCodeRange, 0, len(items))
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			r, err := ParseStatusCodeRange(str)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, r)
+			continue
+		}
+		code, err := toInt(item)
+		if err != nil {
+			return nil, fmt.Errorf("%v (%T) is not a status code", item, item)
+		}
+		result = append(result, StatusCode(code))
+	}
+	return result, nil
+}
+
+// normalizeConfigMap turns the map[interface{}]interface{} maps decoded from YAML into
+// map[string]interface{}, at any depth
+func normalizeConfigMap(m map[string]interface{}) (map[string]interface{}, error) {
+	normalized, err := normalizeConfigValue(m)
+	if err != nil {
+		return nil, err
+	}
+	if normalized == nil {
+		return map[string]interface{}{}, nil
+	}
+	return normalized.(map[string]interface{}), nil
+}
+
+func normalizeConfigValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return nil, nil
+		}
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			normalized, err := normalizeConfigValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = normalized
+		}
+		return result, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			str, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v (%T) is not a string", key, key)
+			}
+			normalized, err := normalizeConfigValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[str] = normalized
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized, err := normalizeConfigValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = normalized
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// Validate reports the first invalid setting of the condition
+func (condition *RetryCondition) Validate() error {
+	if condition.MaxAttempts < 0 {
+		return fmt.Errorf("invalid retry condition: maxAttempts must not be negative, got %d", condition.MaxAttempts)
+	}
+	if condition.MaxDelay < 0 {
+		return fmt.Errorf("invalid retry condition: maxDelay must not be negative, got %d", condition.MaxDelay)
+	}
+	for _, r := range condition.StatusCode {
+		if r.From < 100 || r.To > 599 || r.From > r.To {
+			return fmt.Errorf("invalid retry condition: statusCode %s is not a range of status codes", r)
+		}
+	}
+	for _, class := range condition.ErrorClass {
+		if !class.valid() {
+			return fmt.Errorf("invalid retry condition: unknown errorClass %q", class)
+		}
+	}
+	if len(condition.Exception) == 0 && len(condition.ErrorCode) == 0 && len(condition.StatusCode) == 0 &&
+		len(condition.ErrorClass) == 0 && condition.Predicate == nil {
+		return fmt.Errorf("invalid retry condition: exception, errorCode, statusCode, errorClass or a predicate is required")
+	}
+	return nil
+}
+
+// Validate reports the first invalid condition of the options
+func (options *RetryOptions) Validate() error {
+	for _, key := range []string{"retryCondition", "noRetryCondition"} {
+		conditions := options.RetryCondition
+		if key == "noRetryCondition" {
+			conditions = options.NoRetryCondition
+		}
+		for i, condition := range conditions {
+			if condition == nil {
+				return fmt.Errorf("invalid retry options: %s[%d] is nil", key, i)
+			}
+			if err := condition.Validate(); err != nil {
+				return fmt.Errorf("invalid retry options: %s[%d]: %s", key, i, strings.TrimPrefix(err.Error(), "invalid retry condition: "))
+			}
+		}
+	}
+	return nil
+}
+
+func (condition *RetryCondition) SetMaxAttempts(v int) *RetryCondition {
+	condition.MaxAttempts = v
+	return condition
+}
+
+func (condition *RetryCondition) SetMaxDelay(v int) *RetryCondition {
+	condition.MaxDelay = v
+	return condition
+}
+
+func (condition *RetryCondition) SetBackoff(v BackoffPolicy) *RetryCondition {
+	condition.Backoff = v
+	return condition
+}
+
+func (condition *RetryCondition) SetException(v ...string) *RetryCondition {
+	condition.Exception = v
+	return condition
+}
+
+func (condition *RetryCondition) SetErrorCode(v ...string) *RetryCondition {
+	condition.ErrorCode = v
+	return condition
+}
+
+func (condition *RetryCondition) SetStatusCode(v ...StatusCodeRange) *RetryCondition {
+	condition.StatusCode = v
+	return condition
+}
+
+func (condition *RetryCondition) SetErrorClass(v ...ErrorClass) *RetryCondition {
+	condition.ErrorClass = v
+	return condition
+}
+
+func (condition *RetryCondition) SetPredicate(v func(ctx *RetryPolicyContext) bool) *RetryCondition {
+	condition.Predicate = v
+	return condition
+}
+
+func (options *RetryOptions) SetRetryable(v bool) *RetryOptions {
+	options.Retryable = v
+	return options
+}
+
+func (options *RetryOptions) AddRetryCondition(v ...*RetryCondition) *RetryOptions {
+	options.RetryCondition = append(options.RetryCondition, v...)
+	return options
+}
+
+func (options *RetryOptions) AddNoRetryCondition(v ...*RetryCondition) *RetryOptions {
+	options.NoRetryCondition = append(options.NoRetryCondition, v...)
+	return options
+}
+
+func (options *RetryOptions) SetBudget(v *RetryBudget) *RetryOptions {
+	options.Budget = v
+	return options
+}
+
+// ToMap converts the condition back to the map read by ParseRetryCondition, the Predicate is left out
+func (condition *RetryCondition) ToMap() (map[string]interface{}, error) {
+	result := map[string]interface{}{
+		"maxAttempts": condition.MaxAttempts,
+		"maxDelay":    condition.MaxDelay,
+		"exception":   append([]string{}, condition.Exception...),
+		"errorCode":   append([]string{}, condition.ErrorCode...),
+	}
+	if len(condition.StatusCode) > 0 {
+		statusCode := make([]string, 0, len(condition.StatusCode))
+		for _, r := range condition.StatusCode {
+			statusCode = append(statusCode, r.String())
+		}
+		result["statusCode"] = statusCode
+	}
+	if len(condition.ErrorClass) > 0 {
+		errorClass := make([]string, 0, len(condition.ErrorClass))
+		for _, class := range condition.ErrorClass {
+			errorClass = append(errorClass, string(class))
+		}
+		result["errorClass"] = errorClass
+	}
+	if condition.Backoff != nil {
+		backoff, err := backoffToMap(condition.Backoff)
+		if err != nil {
+			return nil, err
+		}
+		result["backoff"] = backoff
+	}
+	return result, nil
+}
+
+// ToMap converts the options back to the map read by ParseRetryOptions, the Budget
+// and the random sources and clocks of the policies are runtime state and left out
+func (options *RetryOptions) ToMap() (map[string]interface{}, error) {
+	result := map[string]interface{}{
+		"retryable": options.Retryable,
+	}
+	for key, conditions := range map[string][]*RetryCondition{
+		"retryCondition":   options.RetryCondition,
+		"noRetryCondition": options.NoRetryCondition,
+	} {
+		list := make([]interface{}, 0, len(conditions))
+		for _, condition := range conditions {
+			if condition == nil {
+				continue
+			}
+			item, err := condition.ToMap()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		result[key] = list
+	}
+	return result, nil
+}
+
+func backoffToMap(policy BackoffPolicy) (map[string]interface{}, error) {
+	switch p := policy.(type) {
+	case *FixedBackoffPolicy:
+		return map[string]interface{}{"policy": "Fixed", "period": p.Period}, nil
+	case *RandomBackoffPolicy:
+		return map[string]interface{}{"policy": "Random", "period": p.Period, "cap": p.Cap}, nil
+	case *ExponentialBackoffPolicy:
+		return map[string]interface{}{"policy": "Exponential", "period": p.Period, "cap": p.Cap}, nil
+	case *EqualJitterBackoffPolicy:
+		return map[string]interface{}{"policy": "EqualJitter", "period": p.Period, "cap": p.Cap}, nil
+	case *FullJitterBackoffPolicy:
+		return map[string]interface{}{"policy": "FullJitter", "period": p.Period, "cap": p.Cap}, nil
+	case *DecorrelatedJitterBackoffPolicy:
+		return map[string]interface{}{"policy": "DecorrelatedJitter", "period": p.Period, "cap": p.Cap}, nil
+	case *ServerDirectedBackoffPolicy:
+		result := map[string]interface{}{"policy": "ServerDirected", "period": p.Period, "cap": p.Cap}
+		if p.Fallback != nil {
+			fallback, err := backoffToMap(p.Fallback)
+			if err != nil {
+				return nil, err
+			}
+			result["fallback"] = fallback
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("backoff policy %T can not be converted to a map", policy)
+}
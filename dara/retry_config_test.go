@@ -0,0 +1,200 @@
+package dara
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+const retryOptionsJSON = `{
+	"retryable": true,
+	"retryCondition": [
+		{
+			"exception": ["Throttling"],
+			"errorCode": ["Throttling.User"],
+			"maxAttempts": 5,
+			"maxDelay": 20000,
+			"backoff": {
+				"policy": "ServerDirected",
+				"cap": 60000,
+				"fallback": {"policy": "EqualJitter", "period": 2, "cap": 10000}
+			}
+		}
+	],
+	"noRetryCondition": [
+		{"errorCode": ["InvalidParameter"]}
+	]
+}`
+
+func TestLoadRetryOptions(t *testing.T) {
+	options, err := LoadRetryOptions([]byte(retryOptionsJSON))
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, options.Retryable)
+	utils.AssertEqual(t, 1, len(options.RetryCondition))
+	condition := options.RetryCondition[0]
+	utils.AssertEqual(t, 5, condition.MaxAttempts)
+	utils.AssertEqual(t, 20000, condition.MaxDelay)
+	utils.AssertEqual(t, []string{"Throttling"}, condition.Exception)
+	backoff := condition.Backoff.(*ServerDirectedBackoffPolicy)
+	utils.AssertEqual(t, 60000, backoff.Cap)
+	utils.AssertEqual(t, 10000, backoff.Fallback.(*EqualJitterBackoffPolicy).Cap)
+	utils.AssertEqual(t, MAX_ATTEMPTS, options.NoRetryCondition[0].MaxAttempts)
+	utils.AssertEqual(t, MAX_DELAY_TIME, options.NoRetryCondition[0].MaxDelay)
+
+	// the options are written back in the format they were read from
+	first, err := options.ToMap()
+	utils.AssertNil(t, err)
+	byt, err := json.Marshal(first)
+	utils.AssertNil(t, err)
+	reloaded, err := LoadRetryOptions(byt)
+	utils.AssertNil(t, err)
+	second, _ := reloaded.ToMap()
+	utils.AssertEqual(t, first, second)
+	utils.AssertEqual(t, "EqualJitter", second["retryCondition"].([]interface{})[0].(map[string]interface{})["backoff"].(map[string]interface{})["fallback"].(map[string]interface{})["policy"])
+
+	_, err = LoadRetryOptions([]byte(`{"retryable": `))
+	utils.AssertContains(t, err.Error(), "invalid retry options: unexpected EOF")
+}
+
+func TestParseRetryOptionsErrors(t *testing.T) {
+	tests := []struct {
+		options map[string]interface{}
+		err     string
+	}{
+		{map[string]interface{}{}, "invalid retry options: retryable is required"},
+		{map[string]interface{}{"retryable": "yes"}, "invalid retry options: retryable must be a bool, got string"},
+		{map[string]interface{}{"retryable": true, "retries": 3}, `invalid retry options: unknown option "retries"`},
+		{map[string]interface{}{"retryable": true, "retryCondition": "all"}, "invalid retry options: retryCondition must be a list, got string"},
+		{map[string]interface{}{"retryable": true, "retryCondition": []interface{}{1}}, "invalid retry options: retryCondition[0]: must be a map, got int"},
+		{map[string]interface{}{"retryable": true, "retryCondition": []interface{}{
+			map[string]interface{}{"exception": []interface{}{"A"}, "maxAttempts": 2.5},
+		}}, "invalid retry options: retryCondition[0]: maxAttempts: 2.5 (float64) is not an integer"},
+		{map[string]interface{}{"retryable": true, "noRetryCondition": []interface{}{
+			map[string]interface{}{"exception": []interface{}{"A", 1}},
+		}}, "invalid retry options: noRetryCondition[0]: exception: 1 (int) is not a string"},
+		{map[string]interface{}{"retryable": true, "retryCondition": []interface{}{
+			map[string]interface{}{"exception": []interface{}{"A"}, "MaxDelay": 10},
+		}}, `invalid retry options: retryCondition[0]: unknown option "MaxDelay"`},
+		{map[string]interface{}{"retryable": true, "retryCondition": []interface{}{
+			map[string]interface{}{"exception": []interface{}{"A"}, "backoff": map[string]interface{}{"policy": "Linear"}},
+		}}, "invalid retry options: retryCondition[0]: backoff: unknown policy type"},
+		{map[string]interface{}{"retryable": true, "retryCondition": []interface{}{
+			map[string]interface{}{"maxAttempts": 3},
+		}}, "invalid retry options: retryCondition[0]: exception, errorCode, statusCode, errorClass or a predicate is required"},
+		{map[string]interface{}{"retryable": true, "retryCondition": []interface{}{
+			map[string]interface{}{"errorCode": []string{"A"}, "maxDelay": -1},
+		}}, "invalid retry options: retryCondition[0]: maxDelay must not be negative, got -1"},
+	}
+	for _, tt := range tests {
+		options, err := ParseRetryOptions(tt.options)
+		utils.AssertNil(t, options)
+		utils.AssertEqual(t, tt.err, err.Error())
+	}
+
+	_, err := ParseRetryCondition(map[string]interface{}{"errorCode": []string{"A"}, "backoff": 1})
+	utils.AssertEqual(t, "invalid retry condition: backoff must be a map, got int", err.Error())
+}
+
+func TestParseRetryOptionsFromYAML(t *testing.T) {
+	// the nested maps decoded from YAML have interface{} keys
+	options, err := ParseRetryOptions(map[string]interface{}{
+		"retryable": true,
+		"retryCondition": []interface{}{
+			map[interface{}]interface{}{
+				"exception":   []interface{}{"Throttling"},
+				"maxAttempts": 4,
+				"backoff":     map[interface{}]interface{}{"policy": "Fixed", "period": 100},
+			},
+		},
+	})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 4, options.RetryCondition[0].MaxAttempts)
+	utils.AssertEqual(t, 100, options.RetryCondition[0].Backoff.(*FixedBackoffPolicy).Period)
+
+	_, err = ParseRetryOptions(map[string]interface{}{
+		"retryable":      true,
+		"retryCondition": []interface{}{map[interface{}]interface{}{1: "a"}},
+	})
+	utils.AssertEqual(t, "invalid retry options: key 1 (int) is not a string", err.Error())
+}
+
+func TestNewRetryOptionsLenient(t *testing.T) {
+	// nothing panics on missing or wrongly typed options
+	options := NewRetryOptions(map[string]interface{}{"retryable": true})
+	utils.AssertEqual(t, true, options.Retryable)
+	utils.AssertEqual(t, 0, len(options.RetryCondition))
+	utils.AssertEqual(t, 0, len(options.NoRetryCondition))
+
+	options = NewRetryOptions(map[string]interface{}{
+		"retryable": "yes",
+		"retryCondition": []interface{}{
+			map[string]interface{}{"exception": []interface{}{"A"}, "maxAttempts": float64(4), "maxDelay": "x"},
+			"not a condition",
+		},
+	})
+	utils.AssertEqual(t, false, options.Retryable)
+	utils.AssertEqual(t, 1, len(options.RetryCondition))
+	utils.AssertEqual(t, 4, options.RetryCondition[0].MaxAttempts)
+	utils.AssertEqual(t, MAX_DELAY_TIME, options.RetryCondition[0].MaxDelay)
+	utils.AssertEqual(t, []string{"A"}, options.RetryCondition[0].Exception)
+
+	condition := NewRetryCondition(map[string]interface{}{"backoff": "Fixed"})
+	utils.AssertNil(t, condition.Backoff)
+	utils.AssertEqual(t, MAX_ATTEMPTS, condition.MaxAttempts)
+
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"retryOptions": map[string]interface{}{"retryable": true},
+	})
+	utils.AssertEqual(t, true, runtime.RetryOptions.Retryable)
+}
+
+func TestRetryOptionsSetters(t *testing.T) {
+	budget := NewRetryBudget(nil)
+	options := new(RetryOptions).
+		SetRetryable(true).
+		SetBudget(budget).
+		AddRetryCondition(new(RetryCondition).
+			SetException("Throttling").
+			SetErrorCode("Throttling.User").
+			SetMaxAttempts(4).
+			SetMaxDelay(5000).
+			SetBackoff(&FixedBackoffPolicy{Period: 100})).
+		AddNoRetryCondition(new(RetryCondition).SetErrorCode("InvalidParameter"))
+	utils.AssertNil(t, options.Validate())
+	utils.AssertEqual(t, budget, options.Budget)
+
+	result, err := options.ToMap()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, map[string]interface{}{
+		"retryable": true,
+		"retryCondition": []interface{}{
+			map[string]interface{}{
+				"maxAttempts": 4,
+				"maxDelay":    5000,
+				"exception":   []string{"Throttling"},
+				"errorCode":   []string{"Throttling.User"},
+				"backoff":     map[string]interface{}{"policy": "Fixed", "period": 100},
+			},
+		},
+		"noRetryCondition": []interface{}{
+			map[string]interface{}{
+				"maxAttempts": 0,
+				"maxDelay":    0,
+				"exception":   []string{},
+				"errorCode":   []string{"InvalidParameter"},
+			},
+		},
+	}, result)
+
+	options.AddRetryCondition(nil)
+	utils.AssertEqual(t, "invalid retry options: retryCondition[1] is nil", options.Validate().Error())
+
+	options = new(RetryOptions).AddRetryCondition(new(RetryCondition).SetErrorCode("A").SetBackoff(&recordingBackoff{}))
+	_, err = options.ToMap()
+	utils.AssertContains(t, err.Error(), "backoff policy *dara.recordingBackoff can not be converted to a map")
+
+	// the config format stays behind ToMap, a runtime holding such options still marshals
+	_, err = json.Marshal(&RuntimeObject{RetryOptions: options})
+	utils.AssertNil(t, err)
+}
@@ -3,8 +3,20 @@ package dara
 import (
 	// "fmt"
 	// "math"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
 )
 
 type AErr struct {
@@ -617,3 +629,484 @@ func TestRetryAfter(t *testing.T) {
 		t.Errorf("Expected backoff time must be 1000, got: %d", delay)
 	}
 }
+
+type retryTestErr struct {
+	name string
+	code string
+}
+
+func (err *retryTestErr) Error() string {
+	return err.name + ": " + err.code
+}
+
+func (err *retryTestErr) GetName() *string {
+	return String(err.name)
+}
+
+func (err *retryTestErr) GetCode() *string {
+	return String(err.code)
+}
+
+func TestDoRequestWithRetry(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+
+	var bodies []string
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			byt, _ := ioutil.ReadAll(req.Body)
+			bodies = append(bodies, string(byt))
+			if len(bodies) < 3 {
+				return nil, &retryTestErr{name: "AErr", code: "Throttling"}
+			}
+			return mockResponse(200, `ok`, nil)
+		}
+	}
+
+	runtime := &RuntimeObject{
+		RetryOptions: &RetryOptions{
+			Retryable: true,
+			RetryCondition: []*RetryCondition{
+				{MaxAttempts: 3, Exception: []string{"AErr"}, Backoff: &FixedBackoffPolicy{Period: 1}, MaxDelay: 10},
+			},
+		},
+	}
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Body = strings.NewReader("payload")
+	resp, err := DoRequestWithRetry(context.Background(), request, runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, IntValue(resp.StatusCode))
+	utils.AssertEqual(t, []string{"payload", "payload", "payload"}, bodies)
+
+	// retries exhausted
+	bodies = nil
+	runtime.RetryOptions.RetryCondition[0].MaxAttempts = 2
+	request.Body = strings.NewReader("payload")
+	resp, err = DoRequestWithRetry(context.Background(), request, runtime)
+	utils.AssertNil(t, resp)
+	retryErr, ok := err.(*RetryError)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, 2, len(retryErr.Attempts))
+	utils.AssertEqual(t, "AErr: Throttling", errors.Unwrap(err).Error())
+	utils.AssertContains(t, err.Error(), "request failed after 2 attempt(s)", "attempt 1: AErr: Throttling", "attempt 2: AErr: Throttling")
+
+	// a body which can not be rewound is only sent once
+	bodies = nil
+	runtime.RetryOptions.RetryCondition[0].MaxAttempts = 3
+	request.Body = ioutil.NopCloser(strings.NewReader("stream"))
+	_, err = DoRequestWithRetry(context.Background(), request, runtime)
+	utils.AssertEqual(t, []string{"stream"}, bodies)
+	utils.AssertEqual(t, 1, len(err.(*RetryError).Attempts))
+
+	// without retry options there is a single attempt
+	bodies = nil
+	request.Body = strings.NewReader("payload")
+	_, err = DoRequestWithRetry(context.Background(), request, nil)
+	utils.AssertEqual(t, 1, len(bodies))
+	utils.AssertEqual(t, 1, len(err.(*RetryError).Attempts))
+}
+
+func TestDoRequestWithRetryFileBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		byt, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(byt))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	file, err := ioutil.TempFile("", "retry-body")
+	utils.AssertNil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("payload")
+	utils.AssertNil(t, err)
+	_, err = file.Seek(0, io.SeekStart)
+	utils.AssertNil(t, err)
+
+	runtime := &RuntimeObject{
+		NoProxy: String(host),
+		RetryOptions: &RetryOptions{
+			Retryable: true,
+			RetryCondition: []*RetryCondition{
+				{MaxAttempts: 3, StatusCode: []StatusCodeRange{StatusCode(503)}, Backoff: &FixedBackoffPolicy{Period: 1}, MaxDelay: 10},
+			},
+		},
+	}
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Headers["host"] = String(host)
+	request.Body = file
+	resp, err := DoRequestWithRetry(context.Background(), request, runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, IntValue(resp.StatusCode))
+	utils.AssertEqual(t, []string{"payload", "payload", "payload"}, bodies)
+	// the file is handed back to the request and closed once
+	utils.AssertEqual(t, file, request.Body)
+	_, err = file.Seek(0, io.SeekStart)
+	utils.AssertContains(t, err.Error(), "file already closed")
+}
+
+func TestDoRequestWithRetryCancelledDuringBackoff(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			return nil, &retryTestErr{name: "AErr", code: "Throttling"}
+		}
+	}
+
+	runtime := &RuntimeObject{
+		RetryOptions: &RetryOptions{
+			Retryable: true,
+			RetryCondition: []*RetryCondition{
+				{MaxAttempts: 3, Exception: []string{"AErr"}, Backoff: &FixedBackoffPolicy{Period: 10000}, MaxDelay: 10000},
+			},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := DoRequestWithRetry(ctx, NewRequest(), runtime)
+	utils.AssertEqual(t, true, time.Since(start) < 5*time.Second)
+	utils.AssertEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+	utils.AssertEqual(t, 1, len(err.(*RetryError).Attempts))
+	utils.AssertContains(t, err.Error(), "stopped: context deadline exceeded")
+}
+
+func TestRetryBudget(t *testing.T) {
+	clock := newFakeClock()
+	budget := NewRetryBudget(&RetryBudgetOptions{
+		Ratio:      0.5,
+		MinRetries: 2,
+		Window:     10 * time.Second,
+		Clock:      clock,
+	})
+	utils.AssertEqual(t, true, budget.Withdraw())
+	utils.AssertEqual(t, true, budget.Withdraw())
+	utils.AssertEqual(t, false, budget.Withdraw())
+
+	// every two successes earn another retry
+	budget.RecordSuccess()
+	budget.RecordSuccess()
+	utils.AssertEqual(t, true, budget.Withdraw())
+	utils.AssertEqual(t, false, budget.Withdraw())
+	successes, retries := budget.Stats()
+	utils.AssertEqual(t, 2, successes)
+	utils.AssertEqual(t, 3, retries)
+
+	// the counts age out of the window
+	clock.Advance(5 * time.Second)
+	utils.AssertEqual(t, false, budget.Withdraw())
+	clock.Advance(5 * time.Second)
+	successes, retries = budget.Stats()
+	utils.AssertEqual(t, 0, successes)
+	utils.AssertEqual(t, 0, retries)
+	utils.AssertEqual(t, true, budget.Withdraw())
+
+	var unlimited *RetryBudget
+	utils.AssertEqual(t, true, unlimited.Withdraw())
+	unlimited.RecordSuccess()
+	successes, retries = unlimited.Stats()
+	utils.AssertEqual(t, 0, successes)
+	utils.AssertEqual(t, 0, retries)
+}
+
+func TestShouldRetryWithBudget(t *testing.T) {
+	budget := NewRetryBudget(&RetryBudgetOptions{MinRetries: 1, Clock: newFakeClock()})
+	condition := &RetryCondition{MaxAttempts: 3, Exception: []string{"AErr"}}
+	// the budget is shared by both options
+	options := NewRetryOptions(map[string]interface{}{
+		"retryable":        true,
+		"retryCondition":   []interface{}{},
+		"noRetryCondition": []interface{}{},
+		"budget":           budget,
+	})
+	options.RetryCondition = []*RetryCondition{condition}
+	other := &RetryOptions{Retryable: true, RetryCondition: []*RetryCondition{condition}, Budget: budget}
+
+	ctx := &RetryPolicyContext{RetriesAttempted: 1, Exception: &retryTestErr{name: "AErr"}}
+	utils.AssertEqual(t, true, ShouldRetry(options, ctx))
+	utils.AssertEqual(t, false, ShouldRetry(other, ctx))
+	// the first attempt never needs the budget
+	utils.AssertEqual(t, true, ShouldRetry(other, &RetryPolicyContext{}))
+	// a retry refused by the conditions does not take from the budget
+	for i := 0; i < 10; i++ {
+		budget.RecordSuccess()
+	}
+	utils.AssertEqual(t, false, ShouldRetry(other, &RetryPolicyContext{RetriesAttempted: 3, Exception: &retryTestErr{name: "AErr"}}))
+	utils.AssertEqual(t, true, ShouldRetry(other, ctx))
+}
+
+func TestDoRequestWithRetryBudget(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	fail := true
+	calls := 0
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			calls++
+			if fail {
+				return nil, &retryTestErr{name: "AErr", code: "Throttling"}
+			}
+			return mockResponse(200, `ok`, nil)
+		}
+	}
+
+	budget := NewRetryBudget(&RetryBudgetOptions{MinRetries: 1, Clock: newFakeClock()})
+	runtime := &RuntimeObject{
+		RetryOptions: &RetryOptions{
+			Retryable: true,
+			RetryCondition: []*RetryCondition{
+				{MaxAttempts: 5, Exception: []string{"AErr"}, Backoff: &FixedBackoffPolicy{Period: 1}, MaxDelay: 1},
+			},
+			Budget: budget,
+		},
+	}
+	_, err := DoRequestWithRetry(context.Background(), NewRequest(), runtime)
+	utils.AssertEqual(t, 2, len(err.(*RetryError).Attempts))
+	utils.AssertEqual(t, 2, calls)
+
+	fail = false
+	_, err = DoRequestWithRetry(context.Background(), NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	successes, retries := budget.Stats()
+	utils.AssertEqual(t, 1, successes)
+	utils.AssertEqual(t, 1, retries)
+	// a retryable response returned once the retries are refused is no success
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			return mockResponse(429, ``, nil)
+		}
+	}
+	runtime.RetryOptions.RetryCondition[0].StatusCode = []StatusCodeRange{StatusCode(429)}
+	for i := 0; i < 10; i++ {
+		resp, err := DoRequestWithRetry(context.Background(), NewRequest(), runtime)
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, 429, IntValue(resp.StatusCode))
+	}
+	successes, retries = budget.Stats()
+	utils.AssertEqual(t, 1, successes)
+	utils.AssertEqual(t, 2, retries)
+
+	// nor is a server failure no condition retries
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			return mockResponse(500, ``, nil)
+		}
+	}
+	resp, err := DoRequestWithRetry(context.Background(), NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 500, IntValue(resp.StatusCode))
+	successes, _ = budget.Stats()
+	utils.AssertEqual(t, 1, successes)
+}
+
+func TestShouldRetryLoopRecordsBudgetSuccesses(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	status := 200
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			if status == 0 {
+				return nil, &retryTestErr{name: "AErr", code: "Throttling"}
+			}
+			return mockResponse(status, ``, nil)
+		}
+	}
+
+	budget := NewRetryBudget(&RetryBudgetOptions{Ratio: 0.5, MinRetries: 1, Clock: newFakeClock()})
+	runtime := &RuntimeObject{
+		RetryOptions: &RetryOptions{
+			Retryable: true,
+			RetryCondition: []*RetryCondition{
+				{MaxAttempts: 3, Exception: []string{"AErr"}, StatusCode: []StatusCodeRange{StatusCode(429)}},
+			},
+			Budget: budget,
+		},
+	}
+	// the loop of the generated clients: ShouldRetry around DoRequest
+	call := func() {
+		ctx := &RetryPolicyContext{}
+		for ShouldRetry(runtime.RetryOptions, ctx) {
+			_, err := DoRequest(NewRequest(), runtime)
+			if err == nil {
+				return
+			}
+			ctx = &RetryPolicyContext{RetriesAttempted: ctx.RetriesAttempted + 1, Exception: err}
+		}
+	}
+	for i := 0; i < 4; i++ {
+		call()
+	}
+	successes, retries := budget.Stats()
+	utils.AssertEqual(t, 4, successes)
+	utils.AssertEqual(t, 0, retries)
+
+	// a healthy service earns retries beyond MinRetries
+	status = 0
+	call()
+	successes, retries = budget.Stats()
+	utils.AssertEqual(t, 4, successes)
+	utils.AssertEqual(t, 2, retries)
+
+	// failed and retryable responses earn nothing
+	for _, status = range []int{500, 429} {
+		call()
+	}
+	successes, _ = budget.Stats()
+	utils.AssertEqual(t, 4, successes)
+}
+
+func TestBackoffPolicyFactoryErrors(t *testing.T) {
+	tests := []struct {
+		option map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"policy": 1}, "backoff policy must be a string, got int"},
+		{map[string]interface{}{"policy": "Fixed", "period": "100"}, "invalid backoff option period: 100 (string) is not an integer"},
+		{map[string]interface{}{"policy": "FullJitter", "cap": 1.5}, "invalid backoff option cap: 1.5 (float64) is not an integer"},
+		{map[string]interface{}{"policy": "Random", "rand": 42}, "invalid backoff option rand: int is not a RandSource"},
+		{map[string]interface{}{"policy": "ServerDirected", "clock": "now"}, "invalid backoff option clock: string is not a Clock"},
+		{map[string]interface{}{"policy": "ServerDirected", "fallback": map[string]interface{}{"policy": "Unknown"}}, "invalid backoff option fallback: unknown policy type"},
+		{map[string]interface{}{"policy": "ServerDirected", "fallback": 1}, "invalid backoff option fallback: int is neither a BackoffPolicy nor an option map"},
+	}
+	for _, tt := range tests {
+		policy, err := BackoffPolicyFactory(tt.option)
+		utils.AssertNil(t, policy)
+		utils.AssertEqual(t, tt.err, err.Error())
+	}
+
+	// numbers decoded from JSON or YAML are accepted
+	policy, err := BackoffPolicyFactory(map[string]interface{}{
+		"policy": "EqualJitter",
+		"period": float64(3),
+		"cap":    json.Number("1000"),
+	})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 3, policy.(*EqualJitterBackoffPolicy).Period)
+	utils.AssertEqual(t, 1000, policy.(*EqualJitterBackoffPolicy).Cap)
+
+	// the constructors keep the defaults of wrongly typed options
+	utils.AssertEqual(t, DEFAULT_MAX_CAP, NewFullJitterBackoffPolicy(map[string]interface{}{"cap": "1"}).Cap)
+
+	// every invalid option is reported, the valid ones after it are still applied
+	source := rand.New(rand.NewSource(1))
+	option := map[string]interface{}{"policy": "FullJitter", "period": "3", "cap": 1000, "rand": source, "clock": 1}
+	_, err = BackoffPolicyFactory(option)
+	utils.AssertEqual(t, "invalid backoff option period: 3 (string) is not an integer; invalid backoff option clock: int is not a Clock", err.Error())
+	fullJitter := NewFullJitterBackoffPolicy(option)
+	utils.AssertEqual(t, 0, fullJitter.Period)
+	utils.AssertEqual(t, 1000, fullJitter.Cap)
+	utils.AssertEqual(t, source, fullJitter.Rand)
+}
+
+func TestBackoffPolicyRandSource(t *testing.T) {
+	delays := func() []int {
+		policy, err := BackoffPolicyFactory(map[string]interface{}{
+			"policy": "FullJitter",
+			"period": 3,
+			"cap":    10000,
+			"rand":   rand.New(rand.NewSource(7)),
+		})
+		utils.AssertNil(t, err)
+		var result []int
+		for i := 1; i <= 4; i++ {
+			result = append(result, policy.GetDelayTime(&RetryPolicyContext{RetriesAttempted: i}))
+		}
+		return result
+	}
+	first := delays()
+	// another global seed does not change a sequence drawn from its own source
+	rand.Seed(1)
+	utils.AssertEqual(t, first, delays())
+
+	// no panic when there is nothing to draw from
+	utils.AssertEqual(t, 0, NewRandomBackoffPolicy(map[string]interface{}{"period": 100}).GetDelayTime(&RetryPolicyContext{}))
+}
+
+func TestDecorrelatedJitterBackoffPolicy(t *testing.T) {
+	policy, err := BackoffPolicyFactory(map[string]interface{}{
+		"policy": "DecorrelatedJitter",
+		"period": 100,
+		"cap":    2000,
+		"rand":   rand.New(rand.NewSource(1)),
+	})
+	utils.AssertNil(t, err)
+	previous := 0
+	for i := 1; i <= 20; i++ {
+		delay := policy.GetDelayTime(&RetryPolicyContext{RetriesAttempted: i, PreviousDelay: previous})
+		upper := previous * 3
+		if upper < 300 {
+			upper = 300
+		}
+		if upper > 2000 {
+			upper = 2000
+		}
+		utils.AssertEqual(t, true, delay >= 100 && delay <= upper)
+		previous = delay
+	}
+
+	// the loop passes the delay it waited to the next attempt
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			return nil, &retryTestErr{name: "AErr", code: "Throttling"}
+		}
+	}
+	recorder := &recordingBackoff{delay: 2}
+	runtime := &RuntimeObject{
+		RetryOptions: &RetryOptions{
+			Retryable: true,
+			RetryCondition: []*RetryCondition{
+				{MaxAttempts: 3, Exception: []string{"AErr"}, Backoff: recorder, MaxDelay: 10},
+			},
+		},
+	}
+	DoRequestWithRetry(context.Background(), NewRequest(), runtime)
+	utils.AssertEqual(t, []int{0, 2}, recorder.previous)
+}
+
+type recordingBackoff struct {
+	delay    int
+	previous []int
+}
+
+func (backoff *recordingBackoff) GetDelayTime(ctx *RetryPolicyContext) int {
+	backoff.previous = append(backoff.previous, ctx.PreviousDelay)
+	return backoff.delay
+}
+
+func TestServerDirectedBackoffPolicy(t *testing.T) {
+	clock := newFakeClock()
+	policy, err := BackoffPolicyFactory(map[string]interface{}{
+		"policy":   "ServerDirected",
+		"cap":      60000,
+		"clock":    clock,
+		"fallback": map[string]interface{}{"policy": "Fixed", "period": 250},
+	})
+	utils.AssertNil(t, err)
+
+	response := NewResponse(&http.Response{Header: http.Header{
+		"Retry-After": []string{clock.now.Add(20 * time.Second).Format(http.TimeFormat)},
+	}})
+	utils.AssertEqual(t, 20000, policy.GetDelayTime(&RetryPolicyContext{RetriesAttempted: 1, HttpResponse: response}))
+
+	response = NewResponse(&http.Response{Header: http.Header{
+		"X-Ratelimit-Remaining": []string{"0"},
+		"X-Ratelimit-Reset":     []string{"90"},
+	}})
+	utils.AssertEqual(t, 60000, policy.GetDelayTime(&RetryPolicyContext{RetriesAttempted: 1, HttpResponse: response}))
+
+	err = NewSDKError(map[string]interface{}{"code": "Throttling", "retryAfter": 1200})
+	utils.AssertEqual(t, 1200, policy.GetDelayTime(&RetryPolicyContext{RetriesAttempted: 1, Exception: err}))
+
+	utils.AssertEqual(t, 250, policy.GetDelayTime(&RetryPolicyContext{RetriesAttempted: 1}))
+	utils.AssertEqual(t, 300, NewServerDirectedBackoffPolicy(map[string]interface{}{"period": 300}).GetDelayTime(&RetryPolicyContext{}))
+}
@@ -0,0 +1,277 @@
+package dara
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSSERetryDelay is the delay in milliseconds before reconnecting while the server sent no retry
+	DefaultSSERetryDelay = 3000
+	// DefaultSSEMaxReconnects is how many reconnections in a row may fail before the stream fails
+	DefaultSSEMaxReconnects = 5
+	// DefaultSSEDedupeSize is how many event ids are remembered to drop the replayed events
+	DefaultSSEDedupeSize = 1024
+)
+
+// SSEClientOptions configures an SSEClient
+type SSEClientOptions struct {
+	// Runtime is used to send every request
+	Runtime *RuntimeObject
+	// RetryDelay is the delay in milliseconds before reconnecting until the server sends a retry,
+	// DefaultSSERetryDelay when unset
+	RetryDelay int
+	// MaxReconnects is how many reconnections in a row may fail, DefaultSSEMaxReconnects when unset
+	// and no limit when negative. Receiving an event resets the count.
+	MaxReconnects int
+	// DedupeSize is how many event ids are remembered, DefaultSSEDedupeSize when unset
+	DedupeSize int
+	// ReconnectOnEOF reconnects when the server ends the stream cleanly too, the stream then
+	// ends when the server answers 204 No Content. By default a clean end ends the stream.
+	ReconnectOnEOF bool
+}
+
+// SSEClient reads a server-sent events stream and reconnects when the connection is lost.
+// The requests come from a factory so that every connection sends a fresh request, with
+// the Last-Event-ID header set to the id of the last event received.
+type SSEClient struct {
+	newRequest func() (*Request, error)
+	options    SSEClientOptions
+}
+
+// NewSSEClient creates an SSEClient sending the requests created by newRequest
+func NewSSEClient(newRequest func() (*Request, error), options *SSEClientOptions) *SSEClient {
+	client := &SSEClient{newRequest: newRequest}
+	if options != nil {
+		client.options = *options
+	}
+	if client.options.RetryDelay <= 0 {
+		client.options.RetryDelay = DefaultSSERetryDelay
+	}
+	if client.options.MaxReconnects == 0 {
+		client.options.MaxReconnects = DefaultSSEMaxReconnects
+	}
+	if client.options.DedupeSize <= 0 {
+		client.options.DedupeSize = DefaultSSEDedupeSize
+	}
+	return client
+}
+
+// Stream connects to the server, the stream ends when ctx is done or Close is called
+func (client *SSEClient) Stream(ctx context.Context) *SSEStream {
+	ctx, cancel := context.WithCancel(ctx)
+	return &SSEStream{
+		ctx:    ctx,
+		cancel: cancel,
+		client: client,
+		retry:  time.Duration(client.options.RetryDelay) * time.Millisecond,
+		seen:   newSSEIdSet(client.options.DedupeSize),
+	}
+}
+
+// SSEStream is the stream of events of an SSEClient. Use either Next and Event, like a
+// bufio.Scanner, or Events, and then Err for the error that ended the stream.
+type SSEStream struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	client      *SSEClient
+	body        io.ReadCloser
+	decoder     *SSEDecoder
+	lastEventId string
+	retry       time.Duration
+	seen        *sseIdSet
+	failures    int
+	lastErr     error
+	event       *SSEEvent
+	err         error
+	done        bool
+	closed      bool
+	mu          sync.Mutex
+}
+
+// Next waits for the next event and reports whether there is one, reconnecting as needed.
+// It returns false once the stream ended, Err then tells why.
+func (stream *SSEStream) Next() bool {
+	stream.event = nil
+	for !stream.done {
+		if stream.body == nil {
+			if !stream.connect() {
+				continue
+			}
+		}
+		event, err := stream.decoder.Decode()
+		if retry := stream.decoder.Retry(); retry != nil {
+			stream.retry = time.Duration(*retry) * time.Millisecond
+		}
+		if err != nil {
+			stream.disconnect()
+			if err == io.EOF && !stream.client.options.ReconnectOnEOF {
+				stream.finish(nil)
+			} else if stream.ctx.Err() == nil {
+				// the connection was lost, the next loop reconnects
+				stream.lastErr = err
+				stream.failures++
+			}
+			continue
+		}
+		stream.failures = 0
+		if event.Id != nil {
+			// only the id of a complete event is resumed from, the event cut by the
+			// loss of the connection is sent again
+			stream.lastEventId = *event.Id
+			if *event.Id != "" && !stream.seen.add(*event.Id) {
+				// replayed after a reconnection
+				continue
+			}
+		}
+		stream.event = event
+		return true
+	}
+	return false
+}
+
+// connect sends a new request, after the retry delay when reconnecting
+func (stream *SSEStream) connect() bool {
+	if stream.ctx.Err() != nil {
+		stream.finish(stream.ctx.Err())
+		return false
+	}
+	if stream.failures > 0 {
+		maxReconnects := stream.client.options.MaxReconnects
+		if maxReconnects > 0 && stream.failures > maxReconnects {
+			stream.finish(stream.lastErr)
+			return false
+		}
+		if err := sleepWithContext(stream.ctx, stream.retry); err != nil {
+			stream.finish(err)
+			return false
+		}
+	}
+	request, err := stream.client.newRequest()
+	if err != nil {
+		stream.finish(err)
+		return false
+	}
+	if request.Headers == nil {
+		request.Headers = map[string]*string{}
+	}
+	request.Headers["accept"] = String("text/event-stream")
+	if stream.lastEventId != "" {
+		request.Headers["last-event-id"] = String(stream.lastEventId)
+	}
+	response, err := DoRequestWithCtx(stream.ctx, request, stream.client.options.Runtime)
+	if err != nil {
+		if stream.ctx.Err() != nil {
+			stream.finish(stream.ctx.Err())
+		} else {
+			stream.lastErr = err
+			stream.failures++
+		}
+		return false
+	}
+	switch statusCode := IntValue(response.StatusCode); {
+	case statusCode == http.StatusNoContent:
+		// the server asks not to reconnect
+		response.Body.Close()
+		stream.finish(nil)
+		return false
+	case statusCode < 200 || statusCode >= 300:
+		stream.finish(NewSDKErrorFromResponse(response))
+		return false
+	}
+	stream.body = response.Body
+	stream.decoder = NewSSEDecoder(response.Body)
+	return true
+}
+
+func (stream *SSEStream) disconnect() {
+	if stream.body != nil {
+		stream.body.Close()
+		stream.body = nil
+		stream.decoder = nil
+	}
+}
+
+func (stream *SSEStream) finish(err error) {
+	stream.disconnect()
+	stream.mu.Lock()
+	if stream.closed {
+		err = nil
+	}
+	stream.mu.Unlock()
+	stream.err = err
+	stream.done = true
+	stream.cancel()
+}
+
+// Event returns the event read by the last call to Next
+func (stream *SSEStream) Event() *SSEEvent {
+	return stream.event
+}
+
+// Err returns the error that ended the stream, nil when the server ended it or Close was called
+func (stream *SSEStream) Err() error {
+	return stream.err
+}
+
+// LastEventId returns the id of the last event received, sent as Last-Event-ID on reconnection
+func (stream *SSEStream) LastEventId() string {
+	return stream.lastEventId
+}
+
+// Close ends the stream, it may be called from any goroutine
+func (stream *SSEStream) Close() {
+	stream.mu.Lock()
+	stream.closed = true
+	stream.mu.Unlock()
+	stream.cancel()
+}
+
+// Events delivers the events of the stream on a channel closed once the stream ended, Err
+// then tells why. The goroutine feeding the channel exits when the stream is closed or its
+// context is done, even when nobody reads the channel anymore.
+func (stream *SSEStream) Events() <-chan *SSEEvent {
+	events := make(chan *SSEEvent)
+	go func() {
+		defer close(events)
+		for stream.Next() {
+			select {
+			case events <- stream.Event():
+			case <-stream.ctx.Done():
+				stream.finish(stream.ctx.Err())
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// sseIdSet remembers the latest event ids, up to its size
+type sseIdSet struct {
+	ids   map[string]bool
+	order []string
+	next  int
+}
+
+func newSSEIdSet(size int) *sseIdSet {
+	return &sseIdSet{ids: make(map[string]bool, size), order: make([]string, 0, size)}
+}
+
+// add remembers id and reports whether it was new
+func (set *sseIdSet) add(id string) bool {
+	if set.ids[id] {
+		return false
+	}
+	if len(set.order) < cap(set.order) {
+		set.order = append(set.order, id)
+	} else {
+		delete(set.ids, set.order[set.next])
+		set.order[set.next] = id
+		set.next = (set.next + 1) % len(set.order)
+	}
+	set.ids[id] = true
+	return true
+}
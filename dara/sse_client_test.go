@@ -0,0 +1,165 @@
+package dara
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func newSSEServer(handler func(w http.ResponseWriter, r *http.Request, connection int)) (*httptest.Server, func() (*Request, error)) {
+	var mu sync.Mutex
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connections++
+		connection := connections
+		mu.Unlock()
+		handler(w, r, connection)
+	}))
+	host := strings.TrimPrefix(server.URL, "http://")
+	newRequest := func() (*Request, error) {
+		request := NewRequest()
+		request.Headers["host"] = String(host)
+		return request, nil
+	}
+	return server, newRequest
+}
+
+func writeSSE(w http.ResponseWriter, data string) {
+	w.Write([]byte(data))
+	w.(http.Flusher).Flush()
+}
+
+func TestSSEClientReconnect(t *testing.T) {
+	var lastEventIds []string
+	server, newRequest := newSSEServer(func(w http.ResponseWriter, r *http.Request, connection int) {
+		lastEventIds = append(lastEventIds, r.Header.Get("Last-Event-ID"))
+		utils.AssertEqual(t, "text/event-stream", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		if connection == 1 {
+			writeSSE(w, "retry: 10\n\nid: 1\ndata: a\n\nid: 2\ndata: b\n\nid: 3\ndata: cut")
+			// the connection is lost in the middle of an event
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		// the server replays from the last event id
+		writeSSE(w, "id: 2\ndata: b\n\nid: 3\ndata: c\n\n")
+	})
+	defer server.Close()
+
+	client := NewSSEClient(newRequest, &SSEClientOptions{RetryDelay: 5000})
+	stream := client.Stream(context.Background())
+	var data []string
+	start := time.Now()
+	for stream.Next() {
+		data = append(data, StringValue(stream.Event().Data))
+	}
+	utils.AssertNil(t, stream.Err())
+	utils.AssertEqual(t, []string{"a", "b", "c"}, data)
+	utils.AssertEqual(t, []string{"", "2"}, lastEventIds)
+	utils.AssertEqual(t, "3", stream.LastEventId())
+	// the retry sent by the server replaces RetryDelay
+	utils.AssertEqual(t, true, time.Since(start) < 3*time.Second)
+	utils.AssertEqual(t, false, stream.Next())
+}
+
+func TestSSEClientReconnectOnEOF(t *testing.T) {
+	server, newRequest := newSSEServer(func(w http.ResponseWriter, r *http.Request, connection int) {
+		if connection == 3 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeSSE(w, fmt.Sprintf("id: %d\ndata: %d\n\n", connection, connection))
+	})
+	defer server.Close()
+
+	stream := NewSSEClient(newRequest, &SSEClientOptions{RetryDelay: 1, ReconnectOnEOF: true}).Stream(context.Background())
+	var data []string
+	for stream.Next() {
+		data = append(data, StringValue(stream.Event().Data))
+	}
+	utils.AssertNil(t, stream.Err())
+	utils.AssertEqual(t, []string{"1", "2"}, data)
+}
+
+func TestSSEClientErrors(t *testing.T) {
+	server, newRequest := newSSEServer(func(w http.ResponseWriter, r *http.Request, connection int) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"Code": "Forbidden", "Message": "denied"}`))
+	})
+	defer server.Close()
+	stream := NewSSEClient(newRequest, nil).Stream(context.Background())
+	utils.AssertEqual(t, false, stream.Next())
+	utils.AssertEqual(t, "Forbidden", StringValue(stream.Err().(*SDKError).Code))
+
+	// the reconnections in a row are limited
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	utils.AssertNil(t, err)
+	closedHost := listener.Addr().String()
+	listener.Close()
+	attempts := 0
+	client := NewSSEClient(func() (*Request, error) {
+		attempts++
+		request := NewRequest()
+		request.Headers["host"] = String(closedHost)
+		return request, nil
+	}, &SSEClientOptions{RetryDelay: 1, MaxReconnects: 2})
+	stream = client.Stream(context.Background())
+	utils.AssertEqual(t, false, stream.Next())
+	utils.AssertEqual(t, "ConnectError", StringValue(stream.Err().(BaseError).GetName()))
+	utils.AssertEqual(t, 3, attempts)
+
+	stream = NewSSEClient(func() (*Request, error) {
+		return nil, fmt.Errorf("no credentials")
+	}, nil).Stream(context.Background())
+	utils.AssertEqual(t, false, stream.Next())
+	utils.AssertEqual(t, "no credentials", stream.Err().Error())
+}
+
+func TestSSEClientEvents(t *testing.T) {
+	server, newRequest := newSSEServer(func(w http.ResponseWriter, r *http.Request, connection int) {
+		writeSSE(w, "data: first\n\ndata: second\n\n")
+		<-r.Context().Done()
+	})
+	defer server.Close()
+
+	stream := NewSSEClient(newRequest, nil).Stream(context.Background())
+	events := stream.Events()
+	event := <-events
+	utils.AssertEqual(t, "first", StringValue(event.Data))
+	// the stream ends although the second event is never read
+	stream.Close()
+	for range events {
+	}
+	utils.AssertNil(t, stream.Err())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream = NewSSEClient(newRequest, nil).Stream(ctx)
+	events = stream.Events()
+	<-events
+	cancel()
+	for range events {
+	}
+	utils.AssertEqual(t, context.Canceled, stream.Err())
+}
+
+func TestSSEIdSet(t *testing.T) {
+	set := newSSEIdSet(2)
+	utils.AssertEqual(t, true, set.add("1"))
+	utils.AssertEqual(t, true, set.add("2"))
+	utils.AssertEqual(t, false, set.add("1"))
+	utils.AssertEqual(t, true, set.add("3"))
+	// the oldest id is forgotten
+	utils.AssertEqual(t, true, set.add("1"))
+	utils.AssertEqual(t, false, set.add("3"))
+}
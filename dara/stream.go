@@ -5,10 +5,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"io/ioutil"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 type SSEEvent struct {
@@ -18,53 +19,142 @@ type SSEEvent struct {
 	Retry *int
 }
 
-func parseEvent(lines []string) *SSEEvent {
-	event := &SSEEvent{}
-	for _, line := range lines {
-		if strings.HasPrefix(line, "data:") {
-			var data string
-			if strings.HasPrefix(line, "data: ") {
-				data = strings.TrimPrefix(line, "data: ") + "\n"
-			} else {
-				data = strings.TrimPrefix(line, "data:") + "\n"
-			}
-			if event.Data == nil {
-				event.Data = new(string)
-			}
-			*event.Data += data
-		} else if strings.HasPrefix(line, "event:") {
-			var eventName string
-			if strings.HasPrefix(line, "event: ") {
-				eventName = strings.TrimPrefix(line, "event: ")
-			} else {
-				eventName = strings.TrimPrefix(line, "event:")
-			}
-			event.Event = &eventName
-		} else if strings.HasPrefix(line, "id:") {
-			var id string
-			if strings.HasPrefix(line, "id: ") {
-				id = strings.TrimPrefix(line, "id: ")
-			} else {
-				id = strings.TrimPrefix(line, "id:")
+// SSEDecoder decodes a stream of server-sent events incrementally, as described by the
+// event stream interpretation of the WHATWG HTML standard: lines end with CRLF, LF or CR,
+// a leading UTF-8 BOM is skipped, comments and unknown fields are ignored, an id containing
+// NUL is ignored, a retry which is not a number is ignored, and an event is only dispatched
+// when its block of lines has data and ends with an empty line.
+type SSEDecoder struct {
+	reader      *bufio.Reader
+	started     bool
+	skipLF      bool
+	lastEventId string
+	retry       *int
+	// the fields of the event being read
+	data       *string
+	eventType  *string
+	id         *string
+	eventRetry *int
+}
+
+// NewSSEDecoder creates an SSEDecoder reading r
+func NewSSEDecoder(r io.Reader) *SSEDecoder {
+	return &SSEDecoder{reader: bufio.NewReader(r)}
+}
+
+// Decode returns the next event of the stream. It returns io.EOF once the stream ended,
+// an event cut by the end of the stream is dropped. Id and Retry are only set on the
+// events which have an id or retry field, LastEventId keeps the id across events.
+func (decoder *SSEDecoder) Decode() (*SSEEvent, error) {
+	for {
+		line, err := decoder.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line != "" {
+			decoder.processLine(line)
+			continue
+		}
+		if decoder.data == nil {
+			// a block without data dispatches nothing
+			decoder.pending()
+			continue
+		}
+		data := strings.TrimSuffix(*decoder.data, "\n")
+		event := decoder.pending()
+		event.Data = &data
+		return event, nil
+	}
+}
+
+// LastEventId returns the last event id received, which is sent as Last-Event-ID on reconnection
+func (decoder *SSEDecoder) LastEventId() string {
+	return decoder.lastEventId
+}
+
+// Retry returns the last reconnection time in milliseconds received, nil when none was
+func (decoder *SSEDecoder) Retry() *int {
+	return decoder.retry
+}
+
+// pending returns the event being read without its data and resets it
+func (decoder *SSEDecoder) pending() *SSEEvent {
+	event := &SSEEvent{
+		Id:    decoder.id,
+		Event: decoder.eventType,
+		Retry: decoder.eventRetry,
+	}
+	decoder.data = nil
+	decoder.eventType = nil
+	decoder.id = nil
+	decoder.eventRetry = nil
+	return event
+}
+
+// readLine reads a line ended by CRLF, LF or CR, without its end
+func (decoder *SSEDecoder) readLine() (string, error) {
+	if !decoder.started {
+		decoder.started = true
+		if first, err := decoder.reader.Peek(1); err == nil && first[0] == 0xEF {
+			if bom, err := decoder.reader.Peek(3); err == nil && string(bom) == "\xEF\xBB\xBF" {
+				decoder.reader.Discard(3)
 			}
-			event.Id = &id
-		} else if strings.HasPrefix(line, "retry:") {
-			var retryStr string
-			if strings.HasPrefix(line, "retry: ") {
-				retryStr = strings.TrimPrefix(line, "retry: ")
-			} else {
-				retryStr = strings.TrimPrefix(line, "retry:")
+		}
+	}
+	var line []byte
+	for {
+		b, err := decoder.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if decoder.skipLF {
+			decoder.skipLF = false
+			if b == '\n' {
+				continue
 			}
-			var retry int
-			fmt.Sscanf(retryStr, "%d", &retry)
-			event.Retry = &retry
 		}
+		switch b {
+		case '\r':
+			decoder.skipLF = true
+			return strings.ToValidUTF8(string(line), "\uFFFD"), nil
+		case '\n':
+			return strings.ToValidUTF8(string(line), "\uFFFD"), nil
+		}
+		line = append(line, b)
 	}
-	if event.Data != nil {
-		data := strings.TrimRight(*event.Data, "\n")
-		event.Data = &data
+}
+
+// processLine applies a line which is not empty to the event being read
+func (decoder *SSEDecoder) processLine(line string) {
+	if strings.HasPrefix(line, ":") {
+		// a comment
+		return
+	}
+	field, value := line, ""
+	if index := strings.IndexByte(line, ':'); index >= 0 {
+		field, value = line[:index], strings.TrimPrefix(line[index+1:], " ")
+	}
+	switch field {
+	case "event":
+		decoder.eventType = String(value)
+	case "data":
+		if decoder.data == nil {
+			decoder.data = new(string)
+		}
+		*decoder.data += value + "\n"
+	case "id":
+		if !strings.ContainsRune(value, 0) {
+			decoder.lastEventId = value
+			decoder.id = String(value)
+		}
+	case "retry":
+		if value != "" && strings.Trim(value, "0123456789") == "" {
+			if retry, err := strconv.Atoi(value); err == nil {
+				decoder.retry = Int(retry)
+				decoder.eventRetry = Int(retry)
+			}
+		}
 	}
-	return event
 }
 
 func ReadAsBytes(body io.Reader) ([]byte, error) {
@@ -109,107 +199,126 @@ func ReadAsString(body io.Reader) (string, error) {
 	return string(byt), nil
 }
 
-func ReadAsSSE(body io.ReadCloser, eventChannel chan *SSEEvent, errorChannel chan error) {
-
-	go func() {
-		defer func() {
-			body.Close()
-			close(eventChannel)
-		}()
+// SSEReader reads the events of a response body one at a time, on the goroutine of the caller
+type SSEReader struct {
+	body    io.ReadCloser
+	decoder *SSEDecoder
+	once    sync.Once
+	err     error
+}
 
-		reader := bufio.NewReader(body)
-		var eventLines []string
+// NewSSEReader creates an SSEReader reading body
+func NewSSEReader(body io.ReadCloser) *SSEReader {
+	return &SSEReader{body: body, decoder: NewSSEDecoder(body)}
+}
 
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					// Handle the end of the stream and possibly pending event
-					if len(eventLines) > 0 {
-						event := parseEvent(eventLines)
-						eventChannel <- event
-					}
-					errorChannel <- nil
-					return
-				}
-				errorChannel <- err
-				return
+// Next waits for the next event, it returns io.EOF once the stream ended. When ctx is done
+// while waiting, the body is closed to interrupt the read and ctx.Err() is returned. After
+// an error every call returns that error.
+func (reader *SSEReader) Next(ctx context.Context) (*SSEEvent, error) {
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	if err := ctx.Err(); err != nil {
+		reader.fail(err)
+		return nil, err
+	}
+	if ctx.Done() != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				reader.Close()
+			case <-stop:
 			}
+		}()
+	}
+	event, err := reader.decoder.Decode()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		reader.fail(err)
+		return nil, err
+	}
+	return event, nil
+}
 
-			line = strings.TrimRight(line, "\n")
+// LastEventId returns the last event id received
+func (reader *SSEReader) LastEventId() string {
+	return reader.decoder.LastEventId()
+}
 
-			if line == "" {
-				// End of an SSE event
-				if len(eventLines) > 0 {
-					event := parseEvent(eventLines)
-					eventChannel <- event
-					eventLines = []string{} // Reset for the next event
-				}
-				continue
-			}
+// Close closes the body, it may be called from any goroutine
+func (reader *SSEReader) Close() error {
+	var err error
+	reader.once.Do(func() {
+		err = reader.body.Close()
+	})
+	return err
+}
 
-			eventLines = append(eventLines, line)
-		}
-	}()
+func (reader *SSEReader) fail(err error) {
+	reader.err = err
+	reader.Close()
 }
 
+// ReadAsSSE reads the events of body into eventChannel, sends the error that ended the stream,
+// nil at its end, to errorChannel and then closes eventChannel. The error is sent without
+// waiting, so that the goroutine never blocks on it: errorChannel must have a buffer, or be
+// received from, for the error to be delivered. Prefer ReadAsSSEWithContext, which waits for
+// the error to be received until ctx is done, or SSEReader.
+func ReadAsSSE(body io.ReadCloser, eventChannel chan *SSEEvent, errorChannel chan error) {
+	readAsSSE(context.Background(), body, eventChannel, errorChannel, false)
+}
+
+// ReadAsSSEWithContext reads the events of body as ReadAsSSE does. Once ctx is done the body
+// is closed, which interrupts a pending read, ctx.Err() is sent to errorChannel if it is
+// received, and the goroutine exits, even when nobody reads eventChannel or errorChannel anymore.
+// Until then the error waits to be received.
 func ReadAsSSEWithContext(ctx context.Context, body io.ReadCloser, eventChannel chan *SSEEvent, errorChannel chan error) {
+	readAsSSE(ctx, body, eventChannel, errorChannel, true)
+}
 
+// readAsSSE feeds eventChannel and errorChannel, waitForError tells whether the error waits
+// to be received until ctx is done or is given up at once when nobody receives it
+func readAsSSE(ctx context.Context, body io.ReadCloser, eventChannel chan *SSEEvent, errorChannel chan error, waitForError bool) {
+	reader := NewSSEReader(body)
 	go func() {
+		var err error
 		defer func() {
-			body.Close()
-			close(eventChannel)
-		}()
-
-		reader := bufio.NewReader(body)
-		var eventLines []string
-
-		for {
+			reader.Close()
 			select {
-			case <-ctx.Done():
-				errorChannel <- ctx.Err()
-				return
+			case errorChannel <- err:
 			default:
+				if !waitForError {
+					break
+				}
+				// the error is only given up once ctx is done and nobody receives it
+				select {
+				case errorChannel <- err:
+				case <-ctx.Done():
+				}
 			}
+			close(eventChannel)
+		}()
 
-			line, err := reader.ReadString('\n')
+		for {
+			var event *SSEEvent
+			event, err = reader.Next(ctx)
 			if err != nil {
 				if err == io.EOF {
-					// Handle the end of the stream and possibly pending event
-					if len(eventLines) > 0 {
-						event := parseEvent(eventLines)
-						select {
-						case eventChannel <- event:
-						case <-ctx.Done():
-							errorChannel <- ctx.Err()
-							return
-						}
-					}
-					errorChannel <- nil
-					return
+					err = nil
 				}
-				errorChannel <- err
 				return
 			}
-
-			line = strings.TrimRight(line, "\n")
-
-			if line == "" {
-				// End of an SSE event
-				if len(eventLines) > 0 {
-					event := parseEvent(eventLines)
-					select {
-					case eventChannel <- event:
-					case <-ctx.Done():
-						errorChannel <- ctx.Err()
-						return
-					}
-					eventLines = []string{} // Reset for the next event
-				}
-				continue
+			select {
+			case eventChannel <- event:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
 			}
-
-			eventLines = append(eventLines, line)
 		}
 	}()
 }
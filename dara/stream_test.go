@@ -2,9 +2,13 @@ package dara
 
 import (
 	"context"
+	"errors"
+	"io"
 	"io/ioutil"
+	"runtime"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/alibabacloud-go/tea/utils"
@@ -212,13 +216,19 @@ func Test_ReadAsSSE(t *testing.T) {
 
 }
 
-func Test_parseEvent(t *testing.T) {
+func Test_SSEDecoderBlocks(t *testing.T) {
+	// decode reads the block of lines, ended by an empty line
+	decode := func(lines ...string) (*SSEDecoder, *SSEEvent, error) {
+		decoder := NewSSEDecoder(strings.NewReader(strings.Join(append(lines, "", ""), "\n")))
+		event, err := decoder.Decode()
+		return decoder, event, err
+	}
+
 	// Test case 1: Basic data line
 	t.Run("BasicDataLine", func(t *testing.T) {
-		lines := []string{"data: hello world"}
-		event := parseEvent(lines)
+		_, event, err := decode("data: hello world")
 
-		utils.AssertNotNil(t, event)
+		utils.AssertNil(t, err)
 		utils.AssertNotNil(t, event.Data)
 		utils.AssertEqual(t, "hello world", *event.Data)
 		utils.AssertNil(t, event.Event)
@@ -228,76 +238,51 @@ func Test_parseEvent(t *testing.T) {
 
 	// Test case 2: Data line with space after colon
 	t.Run("DataLineWithSpace", func(t *testing.T) {
-		lines := []string{"data:  hello world"}
-		event := parseEvent(lines)
+		_, event, err := decode("data:  hello world")
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNotNil(t, event.Data)
+		utils.AssertNil(t, err)
 		utils.AssertEqual(t, " hello world", *event.Data)
-		utils.AssertNil(t, event.Event)
-		utils.AssertNil(t, event.Id)
-		utils.AssertNil(t, event.Retry)
 	})
 
 	// Test case 3: Data line without space after colon
 	t.Run("DataLineWithoutSpace", func(t *testing.T) {
-		lines := []string{"data:hello world"}
-		event := parseEvent(lines)
+		_, event, err := decode("data:hello world")
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNotNil(t, event.Data)
+		utils.AssertNil(t, err)
 		utils.AssertEqual(t, "hello world", *event.Data)
-		utils.AssertNil(t, event.Event)
-		utils.AssertNil(t, event.Id)
-		utils.AssertNil(t, event.Retry)
 	})
 
-	// Test case 4: Event line
+	// Test case 4: Event line, a block without data dispatches nothing
 	t.Run("EventLine", func(t *testing.T) {
-		lines := []string{"event: message"}
-		event := parseEvent(lines)
+		_, event, err := decode("event: message")
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNil(t, event.Data)
-		utils.AssertNotNil(t, event.Event)
-		utils.AssertEqual(t, "message", *event.Event)
-		utils.AssertNil(t, event.Id)
-		utils.AssertNil(t, event.Retry)
+		utils.AssertEqual(t, io.EOF, err)
+		utils.AssertNil(t, event)
 	})
 
-	// Test case 5: ID line
+	// Test case 5: ID line, the id is kept for the next events
 	t.Run("IDLine", func(t *testing.T) {
-		lines := []string{"id: 123"}
-		event := parseEvent(lines)
+		decoder, event, err := decode("id: 123")
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNil(t, event.Data)
-		utils.AssertNil(t, event.Event)
-		utils.AssertNotNil(t, event.Id)
-		utils.AssertEqual(t, "123", *event.Id)
-		utils.AssertNil(t, event.Retry)
+		utils.AssertEqual(t, io.EOF, err)
+		utils.AssertNil(t, event)
+		utils.AssertEqual(t, "123", decoder.LastEventId())
 	})
 
-	// Test case 6: Retry line
+	// Test case 6: Retry line, the reconnection time is kept
 	t.Run("RetryLine", func(t *testing.T) {
-		lines := []string{"retry: 5000"}
-		event := parseEvent(lines)
+		decoder, event, err := decode("retry: 5000")
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNil(t, event.Data)
-		utils.AssertNil(t, event.Event)
-		utils.AssertNil(t, event.Id)
-		utils.AssertNotNil(t, event.Retry)
-		utils.AssertEqual(t, 5000, *event.Retry)
+		utils.AssertEqual(t, io.EOF, err)
+		utils.AssertNil(t, event)
+		utils.AssertEqual(t, 5000, IntValue(decoder.Retry()))
 	})
 
 	// Test case 7: Multiline data
 	t.Run("MultilineData", func(t *testing.T) {
-		lines := []string{"data: first line", "data: second line"}
-		event := parseEvent(lines)
+		_, event, err := decode("data: first line", "data: second line")
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNotNil(t, event.Data)
+		utils.AssertNil(t, err)
 		utils.AssertEqual(t, "first line\nsecond line", *event.Data)
 		utils.AssertNil(t, event.Event)
 		utils.AssertNil(t, event.Id)
@@ -306,11 +291,9 @@ func Test_parseEvent(t *testing.T) {
 
 	// Test case 8: Complete event
 	t.Run("CompleteEvent", func(t *testing.T) {
-		lines := []string{"id: 456", "event: notification", "data: welcome", "data: to sse", "retry: 3000"}
-		event := parseEvent(lines)
+		_, event, err := decode("id: 456", "event: notification", "data: welcome", "data: to sse", "retry: 3000")
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNotNil(t, event.Data)
+		utils.AssertNil(t, err)
 		utils.AssertEqual(t, "welcome\nto sse", *event.Data)
 		utils.AssertNotNil(t, event.Event)
 		utils.AssertEqual(t, "notification", *event.Event)
@@ -322,23 +305,18 @@ func Test_parseEvent(t *testing.T) {
 
 	// Test case 9: Empty lines
 	t.Run("EmptyLines", func(t *testing.T) {
-		lines := []string{}
-		event := parseEvent(lines)
+		_, event, err := decode()
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNil(t, event.Data)
-		utils.AssertNil(t, event.Event)
-		utils.AssertNil(t, event.Id)
-		utils.AssertNil(t, event.Retry)
+		utils.AssertEqual(t, io.EOF, err)
+		utils.AssertNil(t, event)
 	})
 
 	// Test case 10: Invalid lines (should be ignored)
 	t.Run("InvalidLines", func(t *testing.T) {
-		lines := []string{"invalid: line", "another: invalid"}
-		event := parseEvent(lines)
+		_, event, err := decode("invalid: line", "another: invalid", "data: kept")
 
-		utils.AssertNotNil(t, event)
-		utils.AssertNil(t, event.Data)
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, "kept", *event.Data)
 		utils.AssertNil(t, event.Event)
 		utils.AssertNil(t, event.Id)
 		utils.AssertNil(t, event.Retry)
@@ -509,3 +487,241 @@ func Test_ReadAsSSEWithContext(t *testing.T) {
 		}
 	})
 }
+
+type sseExpected struct {
+	event string
+	data  string
+	id    string
+}
+
+func decodeAll(t *testing.T, r io.Reader) ([]sseExpected, *SSEDecoder) {
+	decoder := NewSSEDecoder(r)
+	var events []sseExpected
+	for {
+		event, err := decoder.Decode()
+		if err == io.EOF {
+			return events, decoder
+		}
+		utils.AssertNil(t, err)
+		events = append(events, sseExpected{event: StringValue(event.Event), data: StringValue(event.Data), id: StringValue(event.Id)})
+	}
+}
+
+func Test_SSEDecoderConformance(t *testing.T) {
+	tests := []struct {
+		name     string
+		stream   string
+		expected []sseExpected
+	}{
+		{"LF", "data: a\n\ndata: b\n\n", []sseExpected{{data: "a"}, {data: "b"}}},
+		{"CRLF", "data: a\r\n\r\ndata: b\r\n\r\n", []sseExpected{{data: "a"}, {data: "b"}}},
+		{"CR", "data: a\r\rdata: b\r\r", []sseExpected{{data: "a"}, {data: "b"}}},
+		{"MixedLineEndings", "data: a\rdata: b\r\ndata: c\n\r\n", []sseExpected{{data: "a\nb\nc"}}},
+		{"BOM", "\xEF\xBB\xBFdata: a\n\n", []sseExpected{{data: "a"}}},
+		{"BOMOnlyAtStart", "data: a\n\n\xEF\xBB\xBFdata: b\n\n", []sseExpected{{data: "a"}}},
+		{"Comments", ": ping\ndata: a\n:\n\n: keep-alive\n\n", []sseExpected{{data: "a"}}},
+		{"FieldWithoutColon", "data\n\ndata\ndata\n\ndata:", []sseExpected{{data: ""}, {data: "\n"}}},
+		{"OneLeadingSpaceRemoved", "data:a\n\ndata:  b \n\n", []sseExpected{{data: "a"}, {data: " b "}}},
+		{"ValueWithColons", "data: a: b:c\n\n", []sseExpected{{data: "a: b:c"}}},
+		{"EventType", "event: add\ndata: 1\n\ndata: 2\n\n", []sseExpected{{event: "add", data: "1"}, {data: "2"}}},
+		{"NoDataNoDispatch", "event: add\n\nid: 1\n\nretry: 10\n\n", nil},
+		{"UnknownFieldsIgnored", "foo: bar\nData: x\ndata: a\n\n", []sseExpected{{data: "a"}}},
+		{"IdWithNULIgnored", "id: 1\ndata: a\n\nid: 2\x003\ndata: b\n\n", []sseExpected{{id: "1", data: "a"}, {data: "b"}}},
+		{"IncompleteEventDropped", "data: a\n\ndata: b\n", []sseExpected{{data: "a"}}},
+		{"IncompleteLineDropped", "data: a\n\ndata: b", []sseExpected{{data: "a"}}},
+		{"InvalidUTF8", "data: a\xffb\n\n", []sseExpected{{data: "a\uFFFDb"}}},
+		{"Empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, _ := decodeAll(t, strings.NewReader(tt.stream))
+			utils.AssertEqual(t, tt.expected, events)
+			// the result does not depend on how the stream is split
+			events, _ = decodeAll(t, iotest.OneByteReader(strings.NewReader(tt.stream)))
+			utils.AssertEqual(t, tt.expected, events)
+		})
+	}
+}
+
+func Test_SSEDecoderState(t *testing.T) {
+	decoder := NewSSEDecoder(strings.NewReader("id: 1\nretry: 100\ndata: a\n\ndata: b\n\nretry: 1s\nid\n\n"))
+	event, err := decoder.Decode()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "1", StringValue(event.Id))
+	utils.AssertEqual(t, 100, IntValue(event.Retry))
+
+	// the last event id holds across events
+	event, err = decoder.Decode()
+	utils.AssertNil(t, err)
+	utils.AssertNil(t, event.Id)
+	utils.AssertNil(t, event.Retry)
+	utils.AssertEqual(t, "1", decoder.LastEventId())
+
+	// an id field without value resets it, a retry which is not a number is ignored
+	_, err = decoder.Decode()
+	utils.AssertEqual(t, io.EOF, err)
+	utils.AssertEqual(t, "", decoder.LastEventId())
+	utils.AssertEqual(t, 100, IntValue(decoder.Retry()))
+}
+
+func Test_SSEDecoderIncremental(t *testing.T) {
+	r, w := io.Pipe()
+	decoder := NewSSEDecoder(r)
+	go func() {
+		// a CRLF split across writes is a single line end
+		w.Write([]byte("data: a\r"))
+		w.Write([]byte("\n\r"))
+		w.Write([]byte("\ndata: b\n"))
+		w.Write([]byte("\n"))
+		w.CloseWithError(errors.New("connection lost"))
+	}()
+	event, err := decoder.Decode()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "a", StringValue(event.Data))
+	event, err = decoder.Decode()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "b", StringValue(event.Data))
+	_, err = decoder.Decode()
+	utils.AssertEqual(t, "connection lost", err.Error())
+}
+
+func Test_SSEReaderNext(t *testing.T) {
+	reader := NewSSEReader(ioutil.NopCloser(strings.NewReader("data: a\n\ndata: b\n\n")))
+	event, err := reader.Next(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "a", StringValue(event.Data))
+	event, err = reader.Next(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "b", StringValue(event.Data))
+	_, err = reader.Next(context.Background())
+	utils.AssertEqual(t, io.EOF, err)
+	_, err = reader.Next(context.Background())
+	utils.AssertEqual(t, io.EOF, err)
+
+	// a blocked read is interrupted by the cancellation of ctx
+	r, w := io.Pipe()
+	defer w.Close()
+	reader = NewSSEReader(r)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		w.Write([]byte("data: a\n\n"))
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	event, err = reader.Next(ctx)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "a", StringValue(event.Data))
+	_, err = reader.Next(ctx)
+	utils.AssertEqual(t, context.Canceled, err)
+	// the body was closed
+	_, err = w.Write([]byte("data: b\n\n"))
+	utils.AssertEqual(t, io.ErrClosedPipe, err)
+	_, err = reader.Next(context.Background())
+	utils.AssertEqual(t, context.Canceled, err)
+}
+
+func Test_ReadAsSSEWithContextNoGoroutineLeak(t *testing.T) {
+	waitForGoroutines := func(n int) int {
+		deadline := time.Now().Add(3 * time.Second)
+		for runtime.NumGoroutine() > n && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return runtime.NumGoroutine()
+	}
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var writers []*io.PipeWriter
+	for i := 0; i < 10; i++ {
+		r, w := io.Pipe()
+		writers = append(writers, w)
+		// nobody reads the channels, which have no buffer
+		eventChannel := make(chan *SSEEvent)
+		errorChannel := make(chan error)
+		ReadAsSSEWithContext(ctx, r, eventChannel, errorChannel)
+		if i%2 == 0 {
+			// an event is waiting to be delivered
+			go w.Write([]byte("data: pending\n\n"))
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	utils.AssertEqual(t, true, waitForGoroutines(before) <= before)
+	for _, w := range writers {
+		w.Close()
+	}
+
+	// the caller stops reading after the first event
+	ctx, cancel = context.WithCancel(context.Background())
+	eventChannel := make(chan *SSEEvent)
+	errorChannel := make(chan error, 1)
+	ReadAsSSEWithContext(ctx, ioutil.NopCloser(strings.NewReader(strings.Repeat("data: event\n\n", 100))), eventChannel, errorChannel)
+	<-eventChannel
+	cancel()
+	for range eventChannel {
+	}
+	utils.AssertEqual(t, context.Canceled, <-errorChannel)
+	utils.AssertEqual(t, true, waitForGoroutines(before) <= before)
+}
+
+// failingReader returns its data and then err
+type failingReader struct {
+	data io.Reader
+	err  error
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	n, err := reader.data.Read(p)
+	if err == io.EOF {
+		return n, reader.err
+	}
+	return n, err
+}
+
+func Test_ReadAsSSEWithContextUnbufferedError(t *testing.T) {
+	readErr := errors.New("connection reset")
+	for i := 0; i < 5; i++ {
+		body := ioutil.NopCloser(&failingReader{data: strings.NewReader("data: first\n\ndata: second\n\n"), err: readErr})
+		eventChannel := make(chan *SSEEvent)
+		errorChannel := make(chan error)
+		ReadAsSSEWithContext(context.Background(), body, eventChannel, errorChannel)
+		var events []string
+		var err error
+	loop:
+		for {
+			select {
+			case event, ok := <-eventChannel:
+				if !ok {
+					break loop
+				}
+				events = append(events, StringValue(event.Data))
+				// the consumer is busy when the stream fails
+				time.Sleep(10 * time.Millisecond)
+			case err = <-errorChannel:
+			}
+		}
+		utils.AssertEqual(t, []string{"first", "second"}, events)
+		utils.AssertEqual(t, readErr, err)
+	}
+}
+
+func Test_ReadAsSSEAbandonedErrorChannel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		body := ioutil.NopCloser(&failingReader{data: strings.NewReader("data: event\n\n"), err: errors.New("connection reset")})
+		eventChannel := make(chan *SSEEvent)
+		// nobody ever reads the error
+		errorChannel := make(chan error)
+		ReadAsSSE(body, eventChannel, errorChannel)
+		var events int
+		for range eventChannel {
+			events++
+		}
+		utils.AssertEqual(t, 1, events)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	utils.AssertEqual(t, true, runtime.NumGoroutine() <= before)
+}
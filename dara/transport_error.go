@@ -0,0 +1,176 @@
+package dara
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// TransportErrorCategory tells which step of the exchange with the server failed
+type TransportErrorCategory string
+
+const (
+	// TransportErrorDNS is a failed lookup of the host
+	TransportErrorDNS TransportErrorCategory = "dns"
+	// TransportErrorConnect is a connection refused, unreachable or closed while dialing
+	TransportErrorConnect TransportErrorCategory = "connect"
+	// TransportErrorTLS is a failed TLS handshake or certificate verification
+	TransportErrorTLS TransportErrorCategory = "tls"
+	// TransportErrorConnectTimeout is a connection or TLS handshake exceeding the ConnectTimeout
+	TransportErrorConnectTimeout TransportErrorCategory = "timeout-connect"
+	// TransportErrorReadTimeout is a response exceeding the ReadTimeout or the BodyIdleTimeout
+	TransportErrorReadTimeout TransportErrorCategory = "timeout-read"
+	// TransportErrorProxy is a failure to connect through the proxy
+	TransportErrorProxy TransportErrorCategory = "proxy"
+	// TransportErrorCanceled is a request cancelled, or out of time, by the context of the caller
+	TransportErrorCanceled TransportErrorCategory = "canceled"
+	// TransportErrorBodyRead is a failure while reading the body of the response
+	TransportErrorBodyRead TransportErrorCategory = "body-read"
+	// TransportErrorUnknown is any other failure
+	TransportErrorUnknown TransportErrorCategory = "unknown"
+)
+
+var transportErrorNames = map[TransportErrorCategory]string{
+	TransportErrorDNS:            "DNSError",
+	TransportErrorConnect:        "ConnectError",
+	TransportErrorTLS:            "TLSError",
+	TransportErrorConnectTimeout: "ConnectTimeoutError",
+	TransportErrorReadTimeout:    "ReadTimeoutError",
+	TransportErrorProxy:          "ProxyError",
+	TransportErrorCanceled:       "CanceledError",
+	TransportErrorBodyRead:       "BodyReadError",
+	TransportErrorUnknown:        "TransportError",
+}
+
+// TransportError is returned by DoRequest when no response was received, or its body could
+// not be read. Its name, such as "DNSError" or "ReadTimeoutError", is stable and may be listed
+// in RetryCondition.Exception, its code is the category. Err is the original error. The errors
+// of the configuration, such as an invalid certificate, and of the interceptors are not wrapped.
+type TransportError struct {
+	Category TransportErrorCategory
+	Err      error
+}
+
+// NewTransportError creates a TransportError of the category wrapping err
+func NewTransportError(category TransportErrorCategory, err error) *TransportError {
+	return &TransportError{Category: category, Err: err}
+}
+
+// Error returns the message of the original error
+func (err *TransportError) Error() string {
+	if err.Err == nil {
+		return string(err.Category)
+	}
+	return err.Err.Error()
+}
+
+func (err *TransportError) GetName() *string {
+	if name, ok := transportErrorNames[err.Category]; ok {
+		return String(name)
+	}
+	return String(transportErrorNames[TransportErrorUnknown])
+}
+
+func (err *TransportError) GetCode() *string {
+	return String(string(err.Category))
+}
+
+// Unwrap returns the original error
+func (err *TransportError) Unwrap() error {
+	return err.Err
+}
+
+// Timeout reports whether the request ran out of time, the context of the caller aside
+func (err *TransportError) Timeout() bool {
+	return err.Category == TransportErrorConnectTimeout || err.Category == TransportErrorReadTimeout
+}
+
+// ClassifyTransportError wraps err in a TransportError of its category, ctx is the context
+// of the caller and tells a cancellation from a timeout. A BaseError, a TransportError
+// included, is returned as is.
+func ClassifyTransportError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var baseErr BaseError
+	if errors.As(err, &baseErr) {
+		return err
+	}
+	return NewTransportError(transportErrorCategory(ctx, err), err)
+}
+
+func transportErrorCategory(ctx context.Context, err error) TransportErrorCategory {
+	if ctx != nil && ctx.Err() != nil {
+		return TransportErrorCanceled
+	}
+	message := err.Error()
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		switch opErr.Op {
+		case "proxyconnect":
+			return TransportErrorProxy
+		case "dial":
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) {
+				return TransportErrorDNS
+			}
+			if opErr.Timeout() {
+				return TransportErrorConnectTimeout
+			}
+			return TransportErrorConnect
+		}
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return TransportErrorDNS
+	}
+	if strings.Contains(message, "proxyconnect") || strings.Contains(message, "socks connect") {
+		return TransportErrorProxy
+	}
+	if strings.Contains(message, "TLS handshake timeout") {
+		return TransportErrorConnectTimeout
+	}
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &recordErr) || errors.As(err, &authorityErr) || errors.As(err, &invalidErr) ||
+		errors.As(err, &hostnameErr) || strings.Contains(message, "tls: ") {
+		return TransportErrorTLS
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return TransportErrorReadTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return TransportErrorCanceled
+	}
+	return TransportErrorUnknown
+}
+
+// transportErrorBody classifies the errors met while reading the body of a response
+type transportErrorBody struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (body *transportErrorBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	var baseErr BaseError
+	if errors.As(err, &baseErr) {
+		return n, err
+	}
+	// timeouts and cancellations are told apart, any other failure is a body-read
+	category := transportErrorCategory(body.ctx, err)
+	if category != TransportErrorReadTimeout && category != TransportErrorCanceled {
+		category = TransportErrorBodyRead
+	}
+	return n, NewTransportError(category, err)
+}
@@ -0,0 +1,151 @@
+package dara
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func TestClassifyTransportError(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	dial := func(err error) error {
+		return fmt.Errorf("Get \"http://example.com\": %w", &net.OpError{Op: "dial", Net: "tcp", Err: err})
+	}
+	tests := []struct {
+		ctx      context.Context
+		err      error
+		category TransportErrorCategory
+		name     string
+	}{
+		{nil, dial(&net.DNSError{Err: "no such host", Name: "example.invalid"}), TransportErrorDNS, "DNSError"},
+		{nil, dial(os.NewSyscallError("connect", syscall.ECONNREFUSED)), TransportErrorConnect, "ConnectError"},
+		{nil, dial(timeoutErr{}), TransportErrorConnectTimeout, "ConnectTimeoutError"},
+		{nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Err: syscall.ECONNREFUSED}, TransportErrorProxy, "ProxyError"},
+		{nil, errors.New("socks connect tcp proxy:1080->example.com:80: unknown error"), TransportErrorProxy, "ProxyError"},
+		{nil, fmt.Errorf("get: %w", x509.UnknownAuthorityError{}), TransportErrorTLS, "TLSError"},
+		{nil, errors.New("remote error: tls: handshake failure"), TransportErrorTLS, "TLSError"},
+		{nil, errors.New("net/http: TLS handshake timeout"), TransportErrorConnectTimeout, "ConnectTimeoutError"},
+		{nil, fmt.Errorf("get: %w", context.DeadlineExceeded), TransportErrorReadTimeout, "ReadTimeoutError"},
+		{nil, timeoutErr{}, TransportErrorReadTimeout, "ReadTimeoutError"},
+		{cancelled, fmt.Errorf("get: %w", context.DeadlineExceeded), TransportErrorCanceled, "CanceledError"},
+		{nil, context.Canceled, TransportErrorCanceled, "CanceledError"},
+		{nil, errors.New("unexpected"), TransportErrorUnknown, "TransportError"},
+	}
+	for _, tt := range tests {
+		err := ClassifyTransportError(tt.ctx, tt.err)
+		transportErr, ok := err.(*TransportError)
+		utils.AssertEqual(t, true, ok)
+		utils.AssertEqual(t, tt.category, transportErr.Category)
+		utils.AssertEqual(t, tt.name, StringValue(transportErr.GetName()))
+		utils.AssertEqual(t, string(tt.category), StringValue(transportErr.GetCode()))
+		utils.AssertEqual(t, tt.err.Error(), err.Error())
+		utils.AssertEqual(t, tt.err, errors.Unwrap(err))
+	}
+
+	// typed errors are left as they are
+	sdkErr := NewSDKError(map[string]interface{}{"code": "Throttling"})
+	utils.AssertEqual(t, sdkErr, ClassifyTransportError(nil, sdkErr))
+	transportErr := NewTransportError(TransportErrorDNS, errors.New("lookup failed"))
+	utils.AssertEqual(t, transportErr, ClassifyTransportError(nil, transportErr))
+	utils.AssertNil(t, ClassifyTransportError(nil, nil))
+
+	utils.AssertEqual(t, true, NewTransportError(TransportErrorReadTimeout, nil).Timeout())
+	utils.AssertEqual(t, false, NewTransportError(TransportErrorCanceled, nil).Timeout())
+	utils.AssertEqual(t, "canceled", NewTransportError(TransportErrorCanceled, nil).Error())
+	utils.AssertEqual(t, "TransportError", StringValue(NewTransportError("other", nil).GetName()))
+	utils.AssertEqual(t, true, ErrorClassTimeout.Matches(NewTransportError(TransportErrorReadTimeout, errors.New("slow"))))
+}
+
+func TestDoRequestTransportErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		case "/truncated":
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	newRequest := func(pathname string) *Request {
+		request := NewRequest()
+		request.Headers["host"] = String(host)
+		request.Pathname = String(pathname)
+		return request
+	}
+	runtime := &RuntimeObject{NoProxy: String(host), ReadTimeout: Int(100)}
+
+	_, err := DoRequest(newRequest("/slow"), runtime)
+	utils.AssertEqual(t, "ReadTimeoutError", StringValue(err.(BaseError).GetName()))
+	utils.AssertEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, err = DoRequestWithCtx(ctx, newRequest("/slow"), &RuntimeObject{NoProxy: String(host)})
+	utils.AssertEqual(t, "CanceledError", StringValue(err.(BaseError).GetName()))
+	utils.AssertEqual(t, true, errors.Is(err, context.Canceled))
+
+	resp, err := DoRequest(newRequest("/truncated"), runtime)
+	utils.AssertNil(t, err)
+	_, err = resp.ReadBody()
+	utils.AssertEqual(t, "BodyReadError", StringValue(err.(BaseError).GetName()))
+
+	// a closed port refuses the connection
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	utils.AssertNil(t, err)
+	closedHost := listener.Addr().String()
+	listener.Close()
+	request := NewRequest()
+	request.Headers["host"] = String(closedHost)
+	_, err = DoRequest(request, &RuntimeObject{NoProxy: String(closedHost)})
+	utils.AssertEqual(t, "ConnectError", StringValue(err.(BaseError).GetName()))
+	utils.AssertEqual(t, true, errors.Is(err, syscall.ECONNREFUSED))
+
+	// the stable names can be retried by exception
+	options := &RetryOptions{
+		Retryable: true,
+		RetryCondition: []*RetryCondition{
+			{MaxAttempts: 3, Exception: []string{"ConnectError", "ReadTimeoutError"}},
+		},
+	}
+	utils.AssertEqual(t, true, ShouldRetry(options, &RetryPolicyContext{RetriesAttempted: 1, Exception: err}))
+
+	// the errors of the configuration and of the interceptors are no transport errors
+	request = newRequest("/")
+	request.Protocol = String("https")
+	_, err = DoRequest(request, &RuntimeObject{NoProxy: String(host), Ca: String("not a certificate")})
+	utils.AssertEqual(t, "Failed to parse root certificate", err.Error())
+	utils.AssertEqual(t, false, errors.As(err, new(*TransportError)))
+	_, err = DoRequest(newRequest("/"), &RuntimeObject{NoProxy: String(host), HttpVersion: String("HTTP/3")})
+	utils.AssertEqual(t, false, errors.As(err, new(*TransportError)))
+	interceptorErr := errors.New("rejected by the interceptor")
+	_, err = DoRequest(newRequest("/"), &RuntimeObject{
+		NoProxy: String(host),
+		Interceptors: []Interceptor{InterceptorFunc(func(request *http.Request, next RoundTripFunc) (*http.Response, error) {
+			return nil, interceptorErr
+		})},
+	})
+	utils.AssertEqual(t, interceptorErr, err)
+}
@@ -98,6 +98,8 @@ type SDKError struct {
 	errMsg             *string
 	Description        *string
 	AccessDeniedDetail map[string]interface{}
+	// Cause is the error the SDKError was created from, returned by Unwrap
+	Cause error
 }
 
 // RuntimeObject is used for converting http configuration
@@ -253,6 +255,10 @@ func NewSDKError(obj map[string]interface{}) *SDKError {
 		}
 	}
 
+	if cause, ok := obj["cause"].(error); ok {
+		err.Cause = cause
+	}
+
 	return err
 }
 
@@ -261,6 +267,11 @@ func (err *SDKError) SetErrMsg(msg string) {
 	err.errMsg = String(msg)
 }
 
+// Unwrap returns the error the SDKError was created from
+func (err *SDKError) Unwrap() error {
+	return err.Cause
+}
+
 func (err *SDKError) Error() string {
 	if err.errMsg == nil {
 		str := fmt.Sprintf("SDKError:\n   StatusCode: %d\n   Code: %s\n   Message: %s\n   Data: %s\n",
@@ -362,7 +373,8 @@ func DoRequest(request *Request, requestRuntime map[string]interface{}) (respons
 			requestURL = fmt.Sprintf("%s?%s", requestURL, querystring)
 		}
 	}
-	debugLog("> %s %s", StringValue(request.Method), requestURL)
+	redaction := utils.GetDebugRedactionPolicy()
+	debugLog("> %s %s", StringValue(request.Method), redaction.RedactURI(requestURL))
 
 	httpRequest, err := http.NewRequest(StringValue(request.Method), requestURL, request.Body)
 	if err != nil {
@@ -403,7 +415,7 @@ func DoRequest(request *Request, requestRuntime map[string]interface{}) (respons
 		} else {
 			httpRequest.Header[key] = []string{*value}
 		}
-		debugLog("> %s: %s", key, StringValue(value))
+		debugLog("> %s: %s", key, redaction.RedactHeader(key, StringValue(value)))
 	}
 	contentlength, _ := strconv.Atoi(StringValue(request.Headers["content-length"]))
 	event := utils.NewProgressEvent(utils.TransferStartedEvent, 0, int64(contentlength), 0)
@@ -432,7 +444,7 @@ func DoRequest(request *Request, requestRuntime map[string]interface{}) (respons
 	fieldMap["{res_headers}"] = transToString(res.Header)
 	debugLog("< HTTP/1.1 %s", res.Status)
 	for key, value := range res.Header {
-		debugLog("< %s: %s", key, strings.Join(value, ""))
+		debugLog("< %s: %s", key, redaction.RedactHeader(key, strings.Join(value, "")))
 		if len(value) != 0 {
 			response.Headers[strings.ToLower(key)] = String(value[0])
 		}
@@ -942,3 +942,14 @@ func Test_TransInt32AndInt(t *testing.T) {
 	b := ToInt32(a)
 	utils.AssertEqual(t, Int32Value(b), int32(10))
 }
+
+func TestSDKErrorUnwrap(t *testing.T) {
+	cause := io.ErrUnexpectedEOF
+	err := NewSDKError(map[string]interface{}{
+		"code":  "ReadFailed",
+		"cause": cause,
+	})
+	utils.AssertEqual(t, cause, err.Unwrap())
+	utils.AssertEqual(t, true, errors.Is(err, io.ErrUnexpectedEOF))
+	utils.AssertNil(t, NewSDKError(map[string]interface{}{"code": "code"}).Unwrap())
+}
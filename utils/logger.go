@@ -8,7 +8,7 @@ import (
 )
 
 var defaultLoggerTemplate = `{time} {channel}: "{method} {uri} HTTP/{version}" {code} {cost} {hostname}`
-var loggerParam = []string{"{time}", "{start_time}", "{ts}", "{channel}", "{pid}", "{host}", "{method}", "{uri}", "{version}", "{target}", "{hostname}", "{code}", "{error}", "{req_headers}", "{res_body}", "{res_headers}", "{cost}"}
+var loggerParam = []string{"{time}", "{start_time}", "{ts}", "{channel}", "{pid}", "{host}", "{method}", "{uri}", "{version}", "{target}", "{hostname}", "{code}", "{error}", "{req_headers}", "{res_body}", "{res_headers}", "{cost}", "{wait}"}
 var logChannel string
 
 type Logger struct {
@@ -16,6 +16,7 @@ type Logger struct {
 	formatTemplate string
 	isOpen         bool
 	lastLogMsg     string
+	redaction      *RedactionPolicy
 }
 
 func InitLogMsg(fieldMap map[string]string) {
@@ -34,6 +35,20 @@ func (logger *Logger) GetFormatTemplate() string {
 
 }
 
+// SetRedactionPolicy sets the policy masking secrets before a line is formatted,
+// an empty RedactionPolicy turns the redaction off
+func (logger *Logger) SetRedactionPolicy(policy *RedactionPolicy) {
+	logger.redaction = policy
+}
+
+// GetRedactionPolicy returns the policy of the logger, DefaultRedactionPolicy when none is set
+func (logger *Logger) GetRedactionPolicy() *RedactionPolicy {
+	if logger.redaction == nil {
+		logger.redaction = DefaultRedactionPolicy()
+	}
+	return logger.redaction
+}
+
 func NewLogger(level string, channel string, out io.Writer, template string) *Logger {
 	if level == "" {
 		level = "info"
@@ -52,6 +67,7 @@ func NewLogger(level string, channel string, out io.Writer, template string) *Lo
 		Logger:         log,
 		formatTemplate: template,
 		isOpen:         true,
+		redaction:      DefaultRedactionPolicy(),
 	}
 }
 
@@ -84,6 +100,11 @@ func SetLogChannel(channel string) {
 }
 
 func (logger *Logger) PrintLog(fieldMap map[string]string, err error) {
+	logger.printLog(fieldMap, err)
+}
+
+// printLog reports the caller of its caller as the log source
+func (logger *Logger) printLog(fieldMap map[string]string, err error) {
 	if err != nil {
 		fieldMap["{error}"] = err.Error()
 	}
@@ -91,13 +112,14 @@ func (logger *Logger) PrintLog(fieldMap map[string]string, err error) {
 	fieldMap["{ts}"] = getTimeInFormatISO8601()
 	fieldMap["{channel}"] = logChannel
 	if logger != nil {
+		logger.GetRedactionPolicy().redactFieldMap(fieldMap)
 		logMsg := logger.formatTemplate
 		for key, value := range fieldMap {
 			logMsg = strings.Replace(logMsg, key, value, -1)
 		}
 		logger.lastLogMsg = logMsg
 		if logger.isOpen == true {
-			logger.Output(2, logMsg)
+			logger.Output(3, logMsg)
 		}
 	}
 }
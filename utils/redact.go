@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const defaultRedactionMask = "***"
+
+// RedactionPolicy masks secrets in request details before they are logged
+type RedactionPolicy struct {
+	// Headers lists the header names, matched case-insensitively, whose values are masked
+	Headers []string
+	// QueryParams masks the values of the query params whose name matches
+	QueryParams []*regexp.Regexp
+	// BodyFields masks, in RedactBody, the values of the JSON body fields whose name matches.
+	// The loggers never log the bodies.
+	BodyFields []*regexp.Regexp
+	// Mask replaces masked values, "***" is used when empty
+	Mask string
+}
+
+var secretNamePattern = regexp.MustCompile(`(?i)(signature|token|secret|password|accesskey)`)
+
+// queryInTextPattern finds the query strings of the urls quoted in a free text
+var queryInTextPattern = regexp.MustCompile("\\?[^\\s\"'`<>]+")
+
+var debugRedaction = struct {
+	sync.RWMutex
+	policy *RedactionPolicy
+}{policy: DefaultRedactionPolicy()}
+
+// SetDebugRedactionPolicy sets the policy applied to the DEBUG output of the clients,
+// a nil policy turns the redaction off
+func SetDebugRedactionPolicy(policy *RedactionPolicy) {
+	debugRedaction.Lock()
+	defer debugRedaction.Unlock()
+	debugRedaction.policy = policy
+}
+
+// GetDebugRedactionPolicy returns the policy applied to the DEBUG output of the clients
+func GetDebugRedactionPolicy() *RedactionPolicy {
+	debugRedaction.RLock()
+	defer debugRedaction.RUnlock()
+	return debugRedaction.policy
+}
+
+// DefaultRedactionPolicy masks the credential headers set by the SDKs and the
+// query params and body fields whose name looks like a secret
+func DefaultRedactionPolicy() *RedactionPolicy {
+	return &RedactionPolicy{
+		Headers: []string{
+			"Authorization",
+			"Proxy-Authorization",
+			"Cookie",
+			"Set-Cookie",
+			"x-acs-security-token",
+			"x-acs-bearer-token",
+			"x-acs-signature",
+		},
+		QueryParams: []*regexp.Regexp{secretNamePattern},
+		BodyFields:  []*regexp.Regexp{secretNamePattern},
+	}
+}
+
+func (policy *RedactionPolicy) mask() string {
+	if policy.Mask == "" {
+		return defaultRedactionMask
+	}
+	return policy.Mask
+}
+
+func (policy *RedactionPolicy) isDeniedHeader(key string) bool {
+	for _, header := range policy.Headers {
+		if strings.EqualFold(header, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []*regexp.Regexp, name string) bool {
+	for _, pattern := range patterns {
+		if pattern != nil && pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeader returns value, or the mask when the header is denied
+func (policy *RedactionPolicy) RedactHeader(key, value string) string {
+	if policy == nil || !policy.isDeniedHeader(key) {
+		return value
+	}
+	return policy.mask()
+}
+
+// RedactHeaders returns a copy of headers with the values of denied headers masked
+func (policy *RedactionPolicy) RedactHeaders(headers map[string][]string) map[string][]string {
+	if policy == nil || headers == nil {
+		return headers
+	}
+	result := make(map[string][]string, len(headers))
+	for key, values := range headers {
+		if policy.isDeniedHeader(key) {
+			result[key] = []string{policy.mask()}
+		} else {
+			result[key] = values
+		}
+	}
+	return result
+}
+
+// RedactQuery masks the values of matching params in a raw query string, keeping its layout
+func (policy *RedactionPolicy) RedactQuery(rawQuery string) string {
+	if policy == nil || rawQuery == "" || len(policy.QueryParams) == 0 {
+		return rawQuery
+	}
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		index := strings.Index(pair, "=")
+		if index < 0 {
+			continue
+		}
+		name, err := url.QueryUnescape(pair[:index])
+		if err != nil {
+			name = pair[:index]
+		}
+		if matchAny(policy.QueryParams, name) {
+			pairs[i] = pair[:index+1] + policy.mask()
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// RedactURI masks the matching query params of a request uri or url
+func (policy *RedactionPolicy) RedactURI(uri string) string {
+	index := strings.Index(uri, "?")
+	if policy == nil || index < 0 {
+		return uri
+	}
+	return uri[:index+1] + policy.RedactQuery(uri[index+1:])
+}
+
+// RedactText masks the matching query params of the urls found in a free text,
+// such as the message of a *url.Error
+func (policy *RedactionPolicy) RedactText(text string) string {
+	if policy == nil || len(policy.QueryParams) == 0 || !strings.Contains(text, "?") {
+		return text
+	}
+	return queryInTextPattern.ReplaceAllStringFunc(text, func(query string) string {
+		return "?" + policy.RedactQuery(query[1:])
+	})
+}
+
+// redactedError is an error with a redacted message, it unwraps to the original error
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (err *redactedError) Error() string {
+	return err.message
+}
+
+func (err *redactedError) Unwrap() error {
+	return err.err
+}
+
+// RedactBody masks the matching fields of a JSON body at any depth,
+// a body that is not JSON is returned unchanged
+func (policy *RedactionPolicy) RedactBody(body string) string {
+	if policy == nil || len(policy.BodyFields) == 0 {
+		return body
+	}
+	return policy.redactJSON(body, func(key string) bool {
+		return matchAny(policy.BodyFields, key)
+	})
+}
+
+// redactHeadersJSON masks the denied headers of headers stringified as a JSON object
+func (policy *RedactionPolicy) redactHeadersJSON(headers string) string {
+	if policy == nil || len(policy.Headers) == 0 {
+		return headers
+	}
+	return policy.redactJSON(headers, policy.isDeniedHeader)
+}
+
+func (policy *RedactionPolicy) redactJSON(raw string, match func(key string) bool) string {
+	trimmed := strings.TrimSpace(raw)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return raw
+	}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return raw
+	}
+	value = policy.redactValue(value, match)
+	buffer := new(bytes.Buffer)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return raw
+	}
+	return strings.TrimSpace(buffer.String())
+}
+
+func (policy *RedactionPolicy) redactValue(value interface{}, match func(key string) bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if match(key) {
+				v[key] = policy.maskValue(item)
+			} else {
+				v[key] = policy.redactValue(item, match)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = policy.redactValue(item, match)
+		}
+	}
+	return value
+}
+
+// maskValue masks value keeping a list a list, as headers are stringified as lists
+func (policy *RedactionPolicy) maskValue(value interface{}) interface{} {
+	if _, ok := value.([]interface{}); ok {
+		return []interface{}{policy.mask()}
+	}
+	return policy.mask()
+}
+
+// RedactRecord returns a copy of record with headers and query params masked,
+// in the message of its error too
+func (policy *RedactionPolicy) RedactRecord(record *LogRecord) *LogRecord {
+	if policy == nil {
+		return record
+	}
+	redacted := *record
+	redacted.URI = policy.RedactURI(record.URI)
+	if index := strings.Index(redacted.URI, "?"); index >= 0 {
+		redacted.Target = redacted.URI[:index] + redacted.URI[index+1:]
+	}
+	redacted.RequestHeaders = policy.RedactHeaders(record.RequestHeaders)
+	redacted.ResponseHeaders = policy.RedactHeaders(record.ResponseHeaders)
+	if record.Error != nil {
+		message := record.Error.Error()
+		if redactedMessage := policy.RedactText(message); redactedMessage != message {
+			redacted.Error = &redactedError{message: redactedMessage, err: record.Error}
+		}
+	}
+	return &redacted
+}
+
+// redactFieldMap masks the secrets in the placeholders of a Logger template
+func (policy *RedactionPolicy) redactFieldMap(fieldMap map[string]string) {
+	if policy == nil {
+		return
+	}
+	for _, key := range []string{"{req_headers}", "{res_headers}"} {
+		if value, ok := fieldMap[key]; ok && value != "" {
+			fieldMap[key] = policy.redactHeadersJSON(value)
+		}
+	}
+	if value, ok := fieldMap["{uri}"]; ok {
+		uri := policy.RedactURI(value)
+		if index := strings.Index(uri, "?"); index >= 0 && uri != value {
+			fieldMap["{target}"] = uri[:index] + uri[index+1:]
+		}
+		fieldMap["{uri}"] = uri
+	}
+	if value, ok := fieldMap["{error}"]; ok && value != "" {
+		fieldMap["{error}"] = policy.RedactText(value)
+	}
+}
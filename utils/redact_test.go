@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func Test_RedactHeaders(t *testing.T) {
+	policy := DefaultRedactionPolicy()
+	AssertEqual(t, "***", policy.RedactHeader("authorization", "acs ak:sign"))
+	AssertEqual(t, "***", policy.RedactHeader("X-Acs-Security-Token", "token"))
+	AssertEqual(t, "application/json", policy.RedactHeader("Accept", "application/json"))
+
+	headers := map[string][]string{
+		"Proxy-Authorization": {"Basic dXNlcjpwYXNz"},
+		"Accept":              {"application/json"},
+	}
+	redacted := policy.RedactHeaders(headers)
+	AssertEqual(t, []string{"***"}, redacted["Proxy-Authorization"])
+	AssertEqual(t, []string{"application/json"}, redacted["Accept"])
+	// the original headers are left untouched
+	AssertEqual(t, []string{"Basic dXNlcjpwYXNz"}, headers["Proxy-Authorization"])
+
+	var nilPolicy *RedactionPolicy
+	AssertEqual(t, "acs ak:sign", nilPolicy.RedactHeader("Authorization", "acs ak:sign"))
+}
+
+func Test_RedactURI(t *testing.T) {
+	policy := DefaultRedactionPolicy()
+	AssertEqual(t, "/?Action=Describe&Signature=***&SecurityToken=***",
+		policy.RedactURI("/?Action=Describe&Signature=abc%2F&SecurityToken=xyz"))
+	AssertEqual(t, "/path", policy.RedactURI("/path"))
+	AssertEqual(t, "/?flag&a=1", policy.RedactURI("/?flag&a=1"))
+
+	policy.QueryParams = []*regexp.Regexp{regexp.MustCompile(`^a$`)}
+	policy.Mask = "[hidden]"
+	AssertEqual(t, "/?a=[hidden]&Signature=abc", policy.RedactURI("/?a=1&Signature=abc"))
+}
+
+func Test_RedactBody(t *testing.T) {
+	policy := DefaultRedactionPolicy()
+	AssertEqual(t, `{"AccessKeySecret":"***","Items":[{"Password":"***","Size":10}],"Name":"test"}`,
+		policy.RedactBody(`{"Name":"test","AccessKeySecret":"secret","Items":[{"Password":"p","Size":10}]}`))
+	AssertEqual(t, "password=secret", policy.RedactBody("password=secret"))
+	AssertEqual(t, `{"broken"`, policy.RedactBody(`{"broken"`))
+}
+
+func Test_RedactText(t *testing.T) {
+	policy := DefaultRedactionPolicy()
+	AssertEqual(t, `Post "http://host/?SecurityToken=***&Action=Run": dial tcp: connection refused`,
+		policy.RedactText(`Post "http://host/?SecurityToken=SECRET&Action=Run": dial tcp: connection refused`))
+	AssertEqual(t, "no url here?", policy.RedactText("no url here?"))
+	var none *RedactionPolicy
+	AssertEqual(t, "/?Signature=abc", none.RedactText("/?Signature=abc"))
+}
+
+func Test_RedactRecord(t *testing.T) {
+	record := newTestRecord()
+	record.URI = "/?Signature=abc&a=1"
+	record.Target = "/Signature=abc&a=1"
+	record.RequestHeaders = map[string][]string{"Authorization": {"acs ak:sign"}}
+
+	redacted := DefaultRedactionPolicy().RedactRecord(record)
+	AssertEqual(t, "/?Signature=***&a=1", redacted.URI)
+	AssertEqual(t, "/Signature=***&a=1", redacted.Target)
+	AssertEqual(t, []string{"***"}, redacted.RequestHeaders["Authorization"])
+	AssertEqual(t, "/?Signature=abc&a=1", record.URI)
+}
+
+func Test_LoggerRedaction(t *testing.T) {
+	byt := new(bytes.Buffer)
+	logger := NewLogger("", "tea", byt, "{uri} {target} {req_headers}")
+	fieldMap := make(map[string]string)
+	InitLogMsg(fieldMap)
+	fieldMap["{uri}"] = "/?Signature=abc"
+	fieldMap["{target}"] = "/Signature=abc"
+	fieldMap["{req_headers}"] = `{"Authorization":["acs ak:sign"],"Accept":["*/*"]}`
+	logger.PrintLog(fieldMap, nil)
+	AssertEqual(t, `/?Signature=*** /Signature=*** {"Accept":["*/*"],"Authorization":["***"]}`, logger.GetLastLogMsg())
+
+	record := newTestRecord()
+	record.RequestHeaders = map[string][]string{"X-Acs-Bearer-Token": {"bearer"}}
+	logger.SetFormatTemplate("{req_headers}")
+	logger.LogRequest(record)
+	AssertEqual(t, `{"X-Acs-Bearer-Token":["***"]}`, logger.GetLastLogMsg())
+
+	// a Logger created without NewLogger still redacts
+	logger = new(Logger)
+	AssertEqual(t, true, logger.GetRedactionPolicy() != nil)
+
+	logger = NewLogger("", "tea", byt, "{req_headers}")
+	logger.SetRedactionPolicy(&RedactionPolicy{})
+	logger.LogRequest(record)
+	AssertEqual(t, `{"X-Acs-Bearer-Token":["bearer"]}`, logger.GetLastLogMsg())
+}
+
+func Test_JSONLoggerRedaction(t *testing.T) {
+	byt := new(bytes.Buffer)
+	logger := NewJSONLogger(byt)
+	record := newTestRecord()
+	record.URI = "/?AccessKeyId=ak&Signature=abc"
+	logger.LogRequest(record)
+	AssertContains(t, byt.String(), `"uri":"/?AccessKeyId=***\u0026Signature=***"`)
+
+	byt.Reset()
+	logger.SetRedactionPolicy(&RedactionPolicy{})
+	logger.LogRequest(record)
+	AssertEqual(t, true, strings.Contains(byt.String(), "Signature=abc"))
+}
+
+func Test_DebugRedactionPolicy(t *testing.T) {
+	origin := GetDebugRedactionPolicy()
+	defer SetDebugRedactionPolicy(origin)
+
+	AssertEqual(t, "***", GetDebugRedactionPolicy().RedactHeader("Authorization", "acs ak:sign"))
+	SetDebugRedactionPolicy(nil)
+	AssertEqual(t, "acs ak:sign", GetDebugRedactionPolicy().RedactHeader("Authorization", "acs ak:sign"))
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRecord holds the typed fields logged for a single request
+type LogRecord struct {
+	Time       time.Time
+	StartTime  time.Time
+	Pid        int
+	Hostname   string
+	Method     string
+	Host       string
+	URI        string
+	Target     string
+	Version    string
+	StatusCode int
+	Cost       time.Duration
+	// Wait is how long the request was held by the rate and concurrency limiters
+	Wait            time.Duration
+	RequestId       string
+	RequestHeaders  map[string][]string
+	ResponseHeaders map[string][]string
+	Error           error
+}
+
+// LogField is a key and typed value of a LogRecord
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger receives every request as a LogRecord instead of a formatted line,
+// the record is not redacted, see RedactionPolicy.RedactRecord
+type StructuredLogger interface {
+	LogRequest(record *LogRecord)
+}
+
+// Level returns "error" for failed requests and "info" otherwise
+func (record *LogRecord) Level() string {
+	if record.Error != nil {
+		return "error"
+	}
+	return "info"
+}
+
+// Fields lists the set fields of the record in a stable order
+func (record *LogRecord) Fields() []LogField {
+	fields := []LogField{
+		{Key: "time", Value: record.Time},
+		{Key: "level", Value: record.Level()},
+		{Key: "channel", Value: logChannel},
+		{Key: "method", Value: record.Method},
+		{Key: "host", Value: record.Host},
+		{Key: "uri", Value: record.URI},
+	}
+	if record.Version != "" {
+		fields = append(fields, LogField{Key: "version", Value: record.Version})
+	}
+	if record.StatusCode != 0 {
+		fields = append(fields, LogField{Key: "status", Value: record.StatusCode})
+	}
+	fields = append(fields,
+		LogField{Key: "start_time", Value: record.StartTime},
+		LogField{Key: "cost", Value: record.Cost},
+	)
+	if record.Wait != 0 {
+		fields = append(fields, LogField{Key: "wait", Value: record.Wait})
+	}
+	if record.RequestId != "" {
+		fields = append(fields, LogField{Key: "request_id", Value: record.RequestId})
+	}
+	if record.Error != nil {
+		fields = append(fields, LogField{Key: "error", Value: record.Error.Error()})
+	}
+	return fields
+}
+
+// FieldMap converts the record to the placeholders of a Logger template
+func (record *LogRecord) FieldMap() map[string]string {
+	fieldMap := make(map[string]string)
+	InitLogMsg(fieldMap)
+	if !record.StartTime.IsZero() {
+		fieldMap["{start_time}"] = record.StartTime.Format("2006-01-02 15:04:05")
+		fieldMap["{cost}"] = record.Cost.String()
+	}
+	if record.Wait != 0 {
+		fieldMap["{wait}"] = record.Wait.String()
+	}
+	if record.Pid != 0 {
+		fieldMap["{pid}"] = strconv.Itoa(record.Pid)
+	}
+	fieldMap["{hostname}"] = record.Hostname
+	fieldMap["{host}"] = record.Host
+	fieldMap["{method}"] = record.Method
+	fieldMap["{uri}"] = record.URI
+	fieldMap["{target}"] = record.Target
+	fieldMap["{version}"] = record.Version
+	if record.StatusCode != 0 {
+		fieldMap["{code}"] = strconv.Itoa(record.StatusCode)
+	}
+	if record.RequestHeaders != nil {
+		fieldMap["{req_headers}"] = stringifyHeaders(record.RequestHeaders)
+	}
+	if record.ResponseHeaders != nil {
+		fieldMap["{res_headers}"] = stringifyHeaders(record.ResponseHeaders)
+	}
+	return fieldMap
+}
+
+// LogRequest prints the record with the format template of the logger
+func (logger *Logger) LogRequest(record *LogRecord) {
+	record = logger.GetRedactionPolicy().RedactRecord(record)
+	logger.printLog(record.FieldMap(), record.Error)
+}
+
+// JSONLogger writes every request as a single line JSON object
+type JSONLogger struct {
+	mu        sync.Mutex
+	out       io.Writer
+	redaction *RedactionPolicy
+}
+
+// NewJSONLogger creates a JSONLogger writing to out with the DefaultRedactionPolicy
+func NewJSONLogger(out io.Writer) *JSONLogger {
+	return &JSONLogger{
+		out:       out,
+		redaction: DefaultRedactionPolicy(),
+	}
+}
+
+// SetRedactionPolicy sets the policy masking secrets before a record is written,
+// an empty RedactionPolicy turns the redaction off
+func (logger *JSONLogger) SetRedactionPolicy(policy *RedactionPolicy) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.redaction = policy
+}
+
+// LogRequest writes the fields of record, times as RFC 3339 and the cost in nanoseconds
+func (logger *JSONLogger) LogRequest(record *LogRecord) {
+	logger.mu.Lock()
+	policy := logger.redaction
+	logger.mu.Unlock()
+	if policy == nil {
+		policy = DefaultRedactionPolicy()
+	}
+	record = policy.RedactRecord(record)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, field := range record.Fields() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		b.Write(key)
+		b.WriteByte(':')
+		var value []byte
+		switch v := field.Value.(type) {
+		case time.Time:
+			value, _ = json.Marshal(v.Format(time.RFC3339Nano))
+		case time.Duration:
+			value = []byte(strconv.FormatInt(int64(v), 10))
+		default:
+			value, _ = json.Marshal(v)
+		}
+		b.Write(value)
+	}
+	b.WriteString("}\n")
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	io.WriteString(logger.out, b.String())
+}
+
+func stringifyHeaders(headers map[string][]string) string {
+	byt, _ := json.Marshal(headers)
+	return string(byt)
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRecord() *LogRecord {
+	return &LogRecord{
+		Time:            time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		StartTime:       time.Date(2024, 1, 2, 3, 4, 4, 0, time.UTC),
+		Pid:             10,
+		Hostname:        "localhost",
+		Method:          "GET",
+		Host:            "ecs.aliyuncs.com",
+		URI:             "/?a=1",
+		Target:          "/a=1",
+		Version:         "1.1",
+		StatusCode:      200,
+		Cost:            1500 * time.Millisecond,
+		RequestId:       "req-1",
+		RequestHeaders:  map[string][]string{"Accept": {"application/json"}},
+		ResponseHeaders: map[string][]string{"X-Acs-Request-Id": {"req-1"}},
+	}
+}
+
+func Test_LogRecordFieldMap(t *testing.T) {
+	fieldMap := newTestRecord().FieldMap()
+	AssertEqual(t, "2024-01-02 03:04:04", fieldMap["{start_time}"])
+	AssertEqual(t, "1.5s", fieldMap["{cost}"])
+	AssertEqual(t, "10", fieldMap["{pid}"])
+	AssertEqual(t, "GET", fieldMap["{method}"])
+	AssertEqual(t, "200", fieldMap["{code}"])
+	AssertEqual(t, `{"Accept":["application/json"]}`, fieldMap["{req_headers}"])
+	AssertEqual(t, `{"X-Acs-Request-Id":["req-1"]}`, fieldMap["{res_headers}"])
+
+	fieldMap = (&LogRecord{}).FieldMap()
+	AssertEqual(t, "", fieldMap["{cost}"])
+	AssertEqual(t, "", fieldMap["{code}"])
+	AssertEqual(t, "", fieldMap["{pid}"])
+	AssertEqual(t, "", fieldMap["{wait}"])
+	AssertEqual(t, len(loggerParam), len(fieldMap))
+}
+
+func Test_LoggerLogRequest(t *testing.T) {
+	byt := new(bytes.Buffer)
+	logger := NewLogger("", "tea", byt, `{method} {host} {code} {cost} {error}`)
+	record := newTestRecord()
+	record.Error = errors.New("tea error")
+	logger.LogRequest(record)
+	AssertEqual(t, "GET ecs.aliyuncs.com 200 1.5s tea error", logger.GetLastLogMsg())
+	AssertEqual(t, true, strings.HasPrefix(byt.String(), "[INFO]structured_logger_test.go:"))
+}
+
+func Test_JSONLogger(t *testing.T) {
+	originlogChannel := logChannel
+	SetLogChannel("tea")
+	defer func() {
+		logChannel = originlogChannel
+	}()
+
+	byt := new(bytes.Buffer)
+	logger := NewJSONLogger(byt)
+	record := newTestRecord()
+	logger.LogRequest(record)
+	record.Error = errors.New("tea error")
+	record.StatusCode = 0
+	logger.LogRequest(record)
+
+	lines := strings.Split(strings.TrimSpace(byt.String()), "\n")
+	AssertEqual(t, 2, len(lines))
+	AssertEqual(t, `{"time":"2024-01-02T03:04:05Z","level":"info","channel":"tea","method":"GET","host":"ecs.aliyuncs.com","uri":"/?a=1","version":"1.1","status":200,"start_time":"2024-01-02T03:04:04Z","cost":1500000000,"request_id":"req-1"}`, lines[0])
+
+	result := make(map[string]interface{})
+	AssertNil(t, json.Unmarshal([]byte(lines[1]), &result))
+	AssertEqual(t, "error", result["level"])
+	AssertEqual(t, "tea error", result["error"])
+	AssertNil(t, result["status"])
+	AssertNil(t, result["wait"])
+
+	byt.Reset()
+	record.Wait = 250 * time.Millisecond
+	logger.LogRequest(record)
+	AssertContains(t, byt.String(), `"cost":1500000000,"wait":250000000,`)
+	AssertEqual(t, "250ms", record.FieldMap()["{wait}"])
+}